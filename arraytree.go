@@ -0,0 +1,460 @@
+package rbtree
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Set is the API shared by RBTree and ArrayTree. It is all that ArrayTree
+// supports.
+type Set interface {
+	Add(elem interface{}) (old interface{}, replaced bool)
+	Remove(elem interface{}) (removed interface{}, ok bool)
+	Contains(elem interface{}) bool
+	Get(probe interface{}) (interface{}, bool)
+	First() (interface{}, bool)
+	Last() (interface{}, bool)
+	Size() int
+	IsEmpty() bool
+	ForEach(f func(interface{}))
+	ToSlice() []interface{}
+	Clear()
+	String() string
+}
+
+var (
+	_ Set = (*RBTree)(nil)
+	_ Set = (*ArrayTree)(nil)
+)
+
+// ArrayTree is a red-black tree whose nodes live in a single growable slice
+// and refer to each other by int32 index. Nodes are smaller than RBTree's and
+// sit close together in memory, which favors large, lookup-heavy sets. Slots
+// freed by Remove are kept on a free list and reused by Add.
+//
+// ArrayTree is deliberately limited to the methods of Set. It has no
+// iterators, views, Try methods, options, handles or hashing, since each
+// relies on stable node pointers; use RBTree for those. Its balancing mirrors
+// RBTree's step for step, so that the same changes leave both trees in the
+// same shape, and TestArrayTree_SameShape holds the two to that.
+//
+// ArrayTree holds at most math.MaxInt32 elements.
+type ArrayTree struct {
+	// nodes[nilIndex] is the sentinel leaf, playing the part of nilNode.
+	nodes []arrayNode
+	root  int32
+
+	// free is the first slot on the free list, linked through right.
+	free int32
+
+	cmp      Comparator
+	size     int
+	modCount int
+}
+
+type arrayNode struct {
+	elem   interface{}
+	parent int32
+	left   int32
+	right  int32
+	color  colorT
+}
+
+const nilIndex int32 = 0
+
+// NewArray returns an empty ArrayTree which uses the given comparator.
+func NewArray(cmp Comparator) *ArrayTree {
+	return &ArrayTree{
+		nodes: make([]arrayNode, 1),
+		cmp:   cmp,
+	}
+}
+
+// Add adds an element to the tree. If an element equal to the one given
+// already exists, it is replaced and returned with replaced set to true.
+func (t *ArrayTree) Add(elem interface{}) (old interface{}, replaced bool) {
+	n, parent, cmp := t.search(elem)
+	if n != nilIndex {
+		old = t.nodes[n].elem
+		t.nodes[n].elem = elem
+		return old, true
+	}
+
+	// The comparator is not called past this point.
+	toAdd := t.alloc()
+	nodes := t.nodes
+	nodes[toAdd] = arrayNode{elem: elem, parent: parent, color: red}
+	if parent != nilIndex {
+		if cmp < 0 {
+			nodes[parent].left = toAdd
+		} else {
+			nodes[parent].right = toAdd
+		}
+	}
+	t.insertFixup(toAdd)
+	t.size += 1
+	t.modCount++
+	return nil, false
+}
+
+// search is RBTree.search for indexes.
+func (t *ArrayTree) search(elem interface{}) (n int32, parent int32, cmp int) {
+	nodes := t.nodes
+	n, parent = t.root, t.root
+	for n != nilIndex {
+		parent = n
+		cmp = t.cmp(elem, nodes[n].elem)
+		if cmp == 0 {
+			return n, parent, cmp
+		} else if cmp < 0 {
+			n = nodes[n].left
+		} else {
+			n = nodes[n].right
+		}
+	}
+	return n, parent, cmp
+}
+
+// alloc returns a free slot, growing nodes if necessary. Indexes held across
+// a call to alloc stay valid, but slices of nodes may not.
+func (t *ArrayTree) alloc() int32 {
+	if i := t.free; i != nilIndex {
+		t.free = t.nodes[i].right
+		return i
+	}
+	if len(t.nodes) > math.MaxInt32 {
+		panic("rbtree: ArrayTree is full")
+	}
+	t.nodes = append(t.nodes, arrayNode{})
+	return int32(len(t.nodes) - 1)
+}
+
+// release puts slot i on the free list, dropping its element.
+func (t *ArrayTree) release(i int32) {
+	t.nodes[i] = arrayNode{right: t.free}
+	t.free = i
+}
+
+// insertFixup is RBTree.rbInsertFixup for indexes.
+func (t *ArrayTree) insertFixup(n int32) {
+	nodes := t.nodes
+	for {
+		parent := nodes[n].parent
+		if parent == nilIndex {
+			nodes[n].color = black
+			t.root = n
+			return
+		}
+		if nodes[parent].color == black {
+			// Tree is valid.
+			return
+		}
+		grandparent := nodes[parent].parent
+		uncle := nodes[grandparent].left
+		if parent == uncle {
+			uncle = nodes[grandparent].right
+		}
+		if nodes[uncle].color == red {
+			nodes[parent].color = black
+			nodes[uncle].color = black
+			nodes[grandparent].color = red
+
+			// Repeat the fixup with the grandparent.
+			n = grandparent
+			continue
+		}
+
+		if parent == nodes[grandparent].left && n == nodes[parent].right {
+			t.rotateLeft(parent)
+			n, parent = parent, n
+		} else if parent == nodes[grandparent].right && n == nodes[parent].left {
+			t.rotateRight(parent)
+			n, parent = parent, n
+		}
+
+		nodes[parent].color = black
+		nodes[grandparent].color = red
+		if n == nodes[parent].left {
+			t.rotateRight(grandparent)
+		} else {
+			t.rotateLeft(grandparent)
+		}
+		return
+	}
+}
+
+// replaceChild is RBTree.replaceChild for indexes.
+func (t *ArrayTree) replaceChild(old int32, n int32) {
+	nodes := t.nodes
+	parent := nodes[old].parent
+	if parent == nilIndex {
+		t.root = n
+	} else if old == nodes[parent].left {
+		nodes[parent].left = n
+	} else {
+		nodes[parent].right = n
+	}
+	if n != nilIndex {
+		nodes[n].parent = parent
+	}
+}
+
+func (t *ArrayTree) rotateLeft(n int32) {
+	nodes := t.nodes
+	right := nodes[n].right
+	t.replaceChild(n, right)
+	nodes[n].right = nodes[right].left
+	if nodes[n].right != nilIndex {
+		nodes[nodes[n].right].parent = n
+	}
+	nodes[right].left = n
+	nodes[n].parent = right
+}
+
+func (t *ArrayTree) rotateRight(n int32) {
+	nodes := t.nodes
+	left := nodes[n].left
+	t.replaceChild(n, left)
+	nodes[n].left = nodes[left].right
+	if nodes[n].left != nilIndex {
+		nodes[nodes[n].left].parent = n
+	}
+	nodes[left].right = n
+	nodes[n].parent = left
+}
+
+// Remove removes the element equal to the one given, using the tree's
+// comparator function for equality determination. It returns the removed
+// element and true, or nil and false if no such element exists.
+func (t *ArrayTree) Remove(elem interface{}) (removed interface{}, ok bool) {
+	n, _, _ := t.search(elem)
+	if n == nilIndex {
+		return nil, false
+	}
+	removed = t.nodes[n].elem
+	t.removeNode(n)
+	return removed, true
+}
+
+// removeNode is RBTree.removeNode for indexes. The freed slot is released.
+func (t *ArrayTree) removeNode(toRemove int32) {
+	nodes := t.nodes
+	spliced := toRemove
+	if nodes[toRemove].left != nilIndex && nodes[toRemove].right != nilIndex {
+		spliced = t.minIndex(nodes[toRemove].right)
+	}
+	child := nodes[spliced].left
+	if child == nilIndex {
+		child = nodes[spliced].right
+	}
+	splicedColor := nodes[spliced].color
+
+	parent := nodes[spliced].parent
+	if spliced == toRemove {
+		t.replaceChild(toRemove, child)
+	} else {
+		if parent == toRemove {
+			parent = spliced
+		} else {
+			t.replaceChild(spliced, child)
+			nodes[spliced].right = nodes[toRemove].right
+			nodes[nodes[spliced].right].parent = spliced
+		}
+		t.replaceChild(toRemove, spliced)
+		nodes[spliced].left = nodes[toRemove].left
+		nodes[nodes[spliced].left].parent = spliced
+		nodes[spliced].color = nodes[toRemove].color
+	}
+
+	if splicedColor == black {
+		if nodes[child].color == red {
+			nodes[child].color = black
+		} else {
+			t.removeFixup(child, parent)
+		}
+	}
+
+	t.release(toRemove)
+	t.size -= 1
+	t.modCount++
+}
+
+// removeFixup is RBTree.rbRemoveFixup for indexes.
+func (t *ArrayTree) removeFixup(child int32, parent int32) {
+	nodes := t.nodes
+	for parent != nilIndex {
+		isLeft := child == nodes[parent].left
+		sibling := nodes[parent].left
+		if isLeft {
+			sibling = nodes[parent].right
+		}
+
+		if nodes[sibling].color == red {
+			nodes[parent].color = red
+			nodes[sibling].color = black
+			if isLeft {
+				t.rotateLeft(parent)
+				sibling = nodes[parent].right
+			} else {
+				t.rotateRight(parent)
+				sibling = nodes[parent].left
+			}
+		}
+
+		near, far := nodes[sibling].left, nodes[sibling].right
+		if !isLeft {
+			near, far = far, near
+		}
+		if nodes[near].color == black && nodes[far].color == black {
+			nodes[sibling].color = red
+			if nodes[parent].color == black {
+				// Repeat the fixup with the parent.
+				child = parent
+				parent = nodes[child].parent
+				continue
+			}
+			nodes[parent].color = black
+			return
+		}
+
+		if nodes[far].color == black {
+			nodes[near].color = black
+			nodes[sibling].color = red
+			if isLeft {
+				t.rotateRight(sibling)
+				sibling = nodes[parent].right
+			} else {
+				t.rotateLeft(sibling)
+				sibling = nodes[parent].left
+			}
+			far = nodes[sibling].right
+			if !isLeft {
+				far = nodes[sibling].left
+			}
+		}
+
+		nodes[sibling].color = nodes[parent].color
+		nodes[parent].color = black
+		nodes[far].color = black
+		if isLeft {
+			t.rotateLeft(parent)
+		} else {
+			t.rotateRight(parent)
+		}
+		return
+	}
+}
+
+// Contains uses the tree's comparator to check if the given element exists.
+func (t *ArrayTree) Contains(elem interface{}) bool {
+	n, _, _ := t.search(elem)
+	return n != nilIndex
+}
+
+// Get returns the stored element equal to probe and true, or nil and false
+// if none exists.
+func (t *ArrayTree) Get(probe interface{}) (interface{}, bool) {
+	if n, _, _ := t.search(probe); n != nilIndex {
+		return t.nodes[n].elem, true
+	}
+	return nil, false
+}
+
+// First returns the tree's smallest element or (nil, false) if t.Size() == 0.
+func (t *ArrayTree) First() (interface{}, bool) {
+	if t.root == nilIndex {
+		return nil, false
+	}
+	return t.nodes[t.minIndex(t.root)].elem, true
+}
+
+// Last returns the tree's largest element or (nil, false) if t.Size() == 0.
+func (t *ArrayTree) Last() (interface{}, bool) {
+	if t.root == nilIndex {
+		return nil, false
+	}
+	n := t.root
+	for t.nodes[n].right != nilIndex {
+		n = t.nodes[n].right
+	}
+	return t.nodes[n].elem, true
+}
+
+func (t *ArrayTree) minIndex(n int32) int32 {
+	for t.nodes[n].left != nilIndex {
+		n = t.nodes[n].left
+	}
+	return n
+}
+
+func (t *ArrayTree) nextIndex(n int32) int32 {
+	nodes := t.nodes
+	if nodes[n].right != nilIndex {
+		return t.minIndex(nodes[n].right)
+	}
+	for nodes[n].parent != nilIndex && n == nodes[nodes[n].parent].right {
+		n = nodes[n].parent
+	}
+	return nodes[n].parent
+}
+
+// Size returns the number of elements in the tree.
+func (t *ArrayTree) Size() int {
+	return t.size
+}
+
+// IsEmpty returns whether the tree is empty.
+func (t *ArrayTree) IsEmpty() bool {
+	return t.size == 0
+}
+
+// ForEach iterates over the tree's elements in sorted order, calling f
+// on each. It panics with ErrModified if f adds or removes elements.
+func (t *ArrayTree) ForEach(f func(interface{})) {
+	if t.root == nilIndex {
+		return
+	}
+	modCount := t.modCount
+	for n := t.minIndex(t.root); n != nilIndex; n = t.nextIndex(n) {
+		f(t.nodes[n].elem)
+		if t.modCount != modCount {
+			panic(ErrModified)
+		}
+	}
+}
+
+// ToSlice returns the tree's elements in a sorted slice.
+func (t *ArrayTree) ToSlice() (s []interface{}) {
+	t.ForEach(func(a interface{}) {
+		s = append(s, a)
+	})
+	return
+}
+
+// Clear removes all elements. The node slice's capacity is kept for reuse.
+func (t *ArrayTree) Clear() {
+	for i := range t.nodes {
+		t.nodes[i] = arrayNode{}
+	}
+	t.nodes = t.nodes[:1]
+	t.root = nilIndex
+	t.free = nilIndex
+	t.size = 0
+	t.modCount++
+}
+
+// String returns a string representation of the tree, including its
+// size and first and last elements, if they exist.
+func (t *ArrayTree) String() string {
+	s := "ArrayTree<"
+	s += "Size: " + strconv.Itoa(t.Size())
+	if first, exists := t.First(); exists {
+		s += ", First: " + fmt.Sprintf("%v", first)
+	}
+	if last, exists := t.Last(); exists {
+		s += ", Last: " + fmt.Sprintf("%v", last)
+	}
+	s += ">"
+	return s
+}
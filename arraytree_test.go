@@ -0,0 +1,258 @@
+package rbtree
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkArrayInvariants is checkInvariants for ArrayTree.
+func checkArrayInvariants(t *testing.T, s *ArrayTree) {
+	t.Helper()
+	nodes := s.nodes
+	if nodes[nilIndex] != (arrayNode{}) {
+		t.Fatal("Sentinel was written.")
+	}
+	if nodes[s.root].color != black || nodes[s.root].parent != nilIndex {
+		t.Fatal("Root is red or has a parent.")
+	}
+	count := 0
+	var prev interface{}
+	var walk func(n int32) int
+	walk = func(n int32) int {
+		if n == nilIndex {
+			return 1
+		}
+		nd := nodes[n]
+		if nd.color == red && (nodes[nd.left].color == red || nodes[nd.right].color == red) {
+			t.Fatalf("Red node %v has a red child.", nd.elem)
+		}
+		if nd.left != nilIndex && nodes[nd.left].parent != n ||
+			nd.right != nilIndex && nodes[nd.right].parent != n {
+			t.Fatalf("Child of %v has wrong parent.", nd.elem)
+		}
+		lh := walk(nd.left)
+		if count > 0 && s.cmp(prev, nd.elem) >= 0 {
+			t.Fatalf("%v is out of order after %v.", nd.elem, prev)
+		}
+		prev = nd.elem
+		count++
+		if rh := walk(nd.right); lh != rh {
+			t.Fatalf("Black height differs below %v.", nd.elem)
+		}
+		if nd.color == black {
+			lh++
+		}
+		return lh
+	}
+	walk(s.root)
+	if count != s.Size() {
+		t.Fatalf("Size is %v, but tree holds %v elements.", s.Size(), count)
+	}
+	free := 0
+	for i := s.free; i != nilIndex; i = nodes[i].right {
+		free++
+	}
+	if count+free+1 != len(nodes) {
+		t.Fatalf("%v live and %v free slots, but %v in total.", count, free, len(nodes)-1)
+	}
+}
+
+func TestArrayTree_MatchesRBTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a, p := NewArray(IntComparator), New(IntComparator)
+	for i := 0; i < 20000; i++ {
+		v := r.Intn(500)
+		if r.Intn(2) == 0 {
+			old1, replaced1 := a.Add(v)
+			old2, replaced2 := p.Add(v)
+			if old1 != old2 || replaced1 != replaced2 {
+				t.Fatalf("Add(%v): (%v, %v) != (%v, %v)", v, old1, replaced1, old2, replaced2)
+			}
+		} else {
+			removed1, ok1 := a.Remove(v)
+			removed2, ok2 := p.Remove(v)
+			if removed1 != removed2 || ok1 != ok2 {
+				t.Fatalf("Remove(%v): (%v, %v) != (%v, %v)", v, removed1, ok1, removed2, ok2)
+			}
+		}
+		if i%100 == 0 {
+			checkArrayInvariants(t, a)
+		}
+	}
+	checkArrayInvariants(t, a)
+	if !reflect.DeepEqual(a.ToSlice(), p.ToSlice()) {
+		t.Fatal("Trees differ.")
+	}
+	first, _ := a.First()
+	last, _ := a.Last()
+	if want, _ := p.First(); first != want {
+		t.Fatalf("Expected first %v. Got %v", want, first)
+	}
+	if want, _ := p.Last(); last != want {
+		t.Fatalf("Expected last %v. Got %v", want, last)
+	}
+}
+
+func TestArrayTree_ReusesFreedSlots(t *testing.T) {
+	s := NewArray(IntComparator)
+	for i := 0; i < 100; i++ {
+		s.Add(i)
+	}
+	for i := 0; i < 50; i++ {
+		s.Remove(i)
+	}
+	for i := 100; i < 150; i++ {
+		s.Add(i)
+	}
+	if len(s.nodes) != 101 {
+		t.Fatalf("Expected 101 slots. Got %v", len(s.nodes))
+	}
+	checkArrayInvariants(t, s)
+}
+
+func TestArrayTree_Get(t *testing.T) {
+	s := NewArray(keyedComparator)
+	s.Add(keyed{1, "a"})
+	if got, ok := s.Get(keyed{key: 1}); !ok || got != (keyed{1, "a"}) {
+		t.Fatalf("Expected ({1 a}, true). Got (%v, %v)", got, ok)
+	}
+	if s.Contains(keyed{key: 2}) {
+		t.Fatal("Contains missing element.")
+	}
+}
+
+func TestArrayTree_Clear(t *testing.T) {
+	s := NewArray(IntComparator)
+	for i := 0; i < 10; i++ {
+		s.Add(i)
+	}
+	s.Clear()
+	if !s.IsEmpty() || s.Contains(5) {
+		t.Fatal("Set not empty after Clear.")
+	}
+	s.Add(1)
+	checkArrayInvariants(t, s)
+}
+
+func TestArrayTree_ForEachPanicsOnModification(t *testing.T) {
+	s := NewArray(IntComparator)
+	for i := 0; i < 10; i++ {
+		s.Add(i)
+	}
+	defer func() {
+		if r := recover(); r != ErrModified {
+			t.Fatalf("Expected ErrModified panic. Got %v", r)
+		}
+	}()
+	s.ForEach(func(e interface{}) { s.Remove(e) })
+}
+
+// --Benchmarks-----
+//
+// Each benchmark runs against both layouts for comparison.
+
+func fillRandom(s Set, n int) []int {
+	elems := make([]int, n)
+	for i := range elems {
+		elems[i] = rand.Int()
+		s.Add(elems[i])
+	}
+	return elems
+}
+
+func benchAdd(b *testing.B, newSet func() Set) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		s := newSet()
+		fillRandom(s, startingSize)
+		b.StartTimer()
+
+		// Timed section.
+		for j := 0; j < opsToBench; j++ {
+			s.Add(rand.Int())
+		}
+	}
+}
+
+func benchContains(b *testing.B, newSet func() Set) {
+	s := newSet()
+	elems := fillRandom(s, startingSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Timed section.
+		for j := 0; j < opsToBench; j++ {
+			s.Contains(elems[(i*opsToBench+j)%startingSize])
+		}
+	}
+}
+
+func benchForEach(b *testing.B, newSet func() Set) {
+	s := newSet()
+	fillRandom(s, startingSize)
+	sum := 0
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Timed section.
+		s.ForEach(func(e interface{}) {
+			sum += e.(int)
+		})
+	}
+}
+
+func newPointerSet() Set { return New(IntComparator) }
+func newArraySet() Set   { return NewArray(IntComparator) }
+
+func BenchmarkLayout_Add_Pointer(b *testing.B)      { benchAdd(b, newPointerSet) }
+func BenchmarkLayout_Add_Array(b *testing.B)        { benchAdd(b, newArraySet) }
+func BenchmarkLayout_Contains_Pointer(b *testing.B) { benchContains(b, newPointerSet) }
+func BenchmarkLayout_Contains_Array(b *testing.B)   { benchContains(b, newArraySet) }
+func BenchmarkLayout_ForEach_Pointer(b *testing.B)  { benchForEach(b, newPointerSet) }
+func BenchmarkLayout_ForEach_Array(b *testing.B)    { benchForEach(b, newArraySet) }
+
+// dumpArrayTree is dumpTree for ArrayTree.
+func dumpArrayTree(s *ArrayTree) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "size=%d ", s.size)
+	var walk func(n int32)
+	walk = func(n int32) {
+		if n == nilIndex {
+			b.WriteString(".")
+			return
+		}
+		nd := s.nodes[n]
+		c := "B"
+		if nd.color == red {
+			c = "R"
+		}
+		fmt.Fprintf(&b, "(%v%s ", nd.elem, c)
+		walk(nd.left)
+		b.WriteString(" ")
+		walk(nd.right)
+		b.WriteString(")")
+	}
+	walk(s.root)
+	return b.String()
+}
+
+func TestArrayTree_SameShape(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	a, p := NewArray(IntComparator), New(IntComparator)
+	for i := 0; i < 5000; i++ {
+		x := r.Intn(300)
+		if r.Intn(3) == 0 {
+			a.Remove(x)
+			p.Remove(x)
+		} else {
+			a.Add(x)
+			p.Add(x)
+		}
+		if i%50 == 0 {
+			if got, want := dumpArrayTree(a), dumpTree(p); got != want {
+				t.Fatalf("Step %v: expected %v. Got %v", i, want, got)
+			}
+		}
+	}
+}
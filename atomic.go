@@ -0,0 +1,117 @@
+package rbtree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// AtomicTree is a sorted set whose readers take no locks. Its contents are a
+// persistent tree, as in a VersionedTree: writers build the next version by
+// copying the path to each change, and publish it by atomically swapping the
+// root, so readers are never blocked by writers or by each other.
+//
+// Each read method loads the current root once and reads from it alone, so
+// ForEach sees a consistent set of elements even while writers run. Use
+// Snapshot to make several reads of the same version.
+//
+// An AtomicTree is safe for concurrent use. Writers are serialized by a
+// mutex. Unlike a VersionedTree, an AtomicTree keeps no past versions.
+type AtomicTree struct {
+	mu      sync.Mutex
+	current atomic.Value // *Snapshot
+}
+
+// NewAtomic returns an empty AtomicTree which uses the given comparator.
+func NewAtomic(cmp Comparator) *AtomicTree {
+	a := &AtomicTree{}
+	a.current.Store(&Snapshot{cmp: cmp})
+	return a
+}
+
+// Snapshot returns the tree's current contents. Later changes to the tree
+// don't affect the snapshot.
+func (a *AtomicTree) Snapshot() *Snapshot {
+	return a.current.Load().(*Snapshot)
+}
+
+// Update calls f to make changes, and publishes them together, so that
+// readers see either all of them or none. If f panics, no changes are
+// published.
+func (a *AtomicTree) Update(f func(w *VersionWriter)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cur := a.Snapshot()
+	if next := cur.update(f); next != cur {
+		a.current.Store(next)
+	}
+}
+
+// Add adds elem, returning the element it replaced as RBTree.Add does.
+func (a *AtomicTree) Add(elem interface{}) (old interface{}, replaced bool) {
+	a.Update(func(w *VersionWriter) {
+		old, replaced = w.Add(elem)
+	})
+	return old, replaced
+}
+
+// Remove removes the element equal to elem, returning it as RBTree.Remove
+// does.
+func (a *AtomicTree) Remove(elem interface{}) (removed interface{}, ok bool) {
+	a.Update(func(w *VersionWriter) {
+		removed, ok = w.Remove(elem)
+	})
+	return removed, ok
+}
+
+// Contains returns whether elem is in the tree.
+func (a *AtomicTree) Contains(elem interface{}) bool {
+	return a.Snapshot().Contains(elem)
+}
+
+// Get returns the element equal to probe, or (nil, false) if none exists.
+func (a *AtomicTree) Get(probe interface{}) (interface{}, bool) {
+	return a.Snapshot().Get(probe)
+}
+
+// Ceiling returns the least element greater than or equal to elem, or
+// (nil, false) if none exists.
+func (a *AtomicTree) Ceiling(elem interface{}) (interface{}, bool) {
+	return a.Snapshot().Ceiling(elem)
+}
+
+// Floor returns the greatest element less than or equal to elem, or
+// (nil, false) if none exists.
+func (a *AtomicTree) Floor(elem interface{}) (interface{}, bool) {
+	return a.Snapshot().Floor(elem)
+}
+
+// First returns the tree's smallest element or (nil, false) if it is empty.
+func (a *AtomicTree) First() (interface{}, bool) {
+	return a.Snapshot().First()
+}
+
+// Last returns the tree's largest element or (nil, false) if it is empty.
+func (a *AtomicTree) Last() (interface{}, bool) {
+	return a.Snapshot().Last()
+}
+
+// Size returns the number of elements in the tree.
+func (a *AtomicTree) Size() int {
+	return a.Snapshot().Size()
+}
+
+// IsEmpty returns whether the tree is empty.
+func (a *AtomicTree) IsEmpty() bool {
+	return a.Snapshot().IsEmpty()
+}
+
+// ForEach iterates over the elements of the current version in sorted order,
+// calling f on each. f may change the tree without affecting the iteration.
+func (a *AtomicTree) ForEach(f func(interface{})) {
+	a.Snapshot().ForEach(f)
+}
+
+// ToSlice returns the tree's elements in a sorted slice.
+func (a *AtomicTree) ToSlice() []interface{} {
+	return a.Snapshot().ToSlice()
+}
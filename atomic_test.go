@@ -0,0 +1,188 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestAtomic_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a := NewAtomic(IntComparator)
+	model := New(IntComparator)
+	for i := 0; i < 5000; i++ {
+		x := r.Intn(500)
+		if r.Intn(3) == 0 {
+			_, ok := a.Remove(x)
+			if _, want := model.Remove(x); ok != want {
+				t.Fatalf("Remove(%v) returned %v.", x, ok)
+			}
+		} else {
+			_, replaced := a.Add(x)
+			if _, want := model.Add(x); replaced != want {
+				t.Fatalf("Add(%v) returned replaced = %v.", x, replaced)
+			}
+		}
+	}
+	checkPersistent(t, a.Snapshot())
+	if !reflect.DeepEqual(a.ToSlice(), model.ToSlice()) {
+		t.Fatalf("Expected %v. Got %v", model.ToSlice(), a.ToSlice())
+	}
+}
+
+func TestAtomic_ForEachWhileWriting(t *testing.T) {
+	a := NewAtomic(IntComparator)
+	for i := 0; i < 10; i++ {
+		a.Add(i)
+	}
+	var got []interface{}
+	a.ForEach(func(elem interface{}) {
+		a.Remove(elem)
+		a.Add(elem.(int) + 100)
+		got = append(got, elem)
+	})
+	if !reflect.DeepEqual(got, ints(0, 10, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(0, 10, 1), got)
+	}
+	if !reflect.DeepEqual(a.ToSlice(), ints(100, 110, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(100, 110, 1), a.ToSlice())
+	}
+}
+
+// TestAtomic_Stress runs readers against writers, and is most useful under
+// the race detector. The writer keeps the elements a contiguous range, which
+// every reader's view must be.
+func TestAtomic_Stress(t *testing.T) {
+	a := NewAtomic(IntComparator)
+	var wg sync.WaitGroup
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := a.Snapshot()
+				elems := s.ToSlice()
+				if len(elems) != s.Size() {
+					t.Errorf("Expected %v elements. Got %v", s.Size(), len(elems))
+					return
+				}
+				for j := 1; j < len(elems); j++ {
+					if elems[j] != elems[j-1].(int)+1 {
+						t.Errorf("Elements %v and %v aren't contiguous.", elems[j-1], elems[j])
+						return
+					}
+				}
+				if len(elems) > 0 && !a.Contains(elems[len(elems)-1]) && a.Contains(elems[0]) {
+					t.Errorf("Element %v removed before %v.", elems[len(elems)-1], elems[0])
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 3000; i++ {
+		a.Update(func(w *VersionWriter) {
+			w.Add(i)
+			if i >= 100 {
+				w.Remove(i - 100)
+			}
+		})
+	}
+	close(done)
+	wg.Wait()
+	checkPersistent(t, a.Snapshot())
+}
+
+func TestAtomic_ConcurrentWriters(t *testing.T) {
+	a := NewAtomic(IntComparator)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(base int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				a.Add(base + j)
+			}
+		}(i * 1000)
+	}
+	wg.Wait()
+	if a.Size() != 4000 {
+		t.Fatalf("Expected size 4000. Got %v", a.Size())
+	}
+	checkPersistent(t, a.Snapshot())
+}
+
+// rwMutexTree is the conventional way to share an RBTree, for comparison.
+type rwMutexTree struct {
+	mu   sync.RWMutex
+	tree *RBTree
+}
+
+func (m *rwMutexTree) Contains(elem interface{}) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tree.Contains(elem)
+}
+
+func (m *rwMutexTree) Add(elem interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree.Add(elem)
+}
+
+func benchmarkParallelContains(b *testing.B, contains func(interface{}) bool, add func(interface{})) {
+	for i := 0; i < startingSize; i++ {
+		add(i * 2)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			contains(r.Intn(startingSize * 2))
+		}
+	})
+}
+
+func BenchmarkContains_Parallel_Atomic(b *testing.B) {
+	a := NewAtomic(IntComparator)
+	benchmarkParallelContains(b, a.Contains, func(elem interface{}) { a.Add(elem) })
+}
+
+func BenchmarkContains_Parallel_RWMutex(b *testing.B) {
+	m := &rwMutexTree{tree: New(IntComparator)}
+	benchmarkParallelContains(b, m.Contains, m.Add)
+}
+
+// benchmarkParallelContainsWriting is benchmarkParallelContains with a
+// writer adding elements throughout.
+func benchmarkParallelContainsWriting(b *testing.B, contains func(interface{}) bool, add func(interface{})) {
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		for i := 1; ; i += 2 {
+			select {
+			case <-done:
+				return
+			default:
+				add(i % (startingSize * 2))
+			}
+		}
+	}()
+	benchmarkParallelContains(b, contains, add)
+}
+
+func BenchmarkContains_Parallel_Writing_Atomic(b *testing.B) {
+	a := NewAtomic(IntComparator)
+	benchmarkParallelContainsWriting(b, a.Contains, func(elem interface{}) { a.Add(elem) })
+}
+
+func BenchmarkContains_Parallel_Writing_RWMutex(b *testing.B) {
+	m := &rwMutexTree{tree: New(IntComparator)}
+	benchmarkParallelContainsWriting(b, m.Contains, m.Add)
+}
@@ -0,0 +1,325 @@
+package rbtree
+
+import (
+	"math/bits"
+)
+
+// RemoveRange removes every element e with lo <= e < hi, returning the number
+// removed. It splits the tree around the range and joins what remains, so it
+// costs O(log n) plus O(k) to count the k removed elements, rather than k
+// separate rebalances.
+func (t *RBTree) RemoveRange(lo, hi interface{}) int {
+	if t.typed {
+		t.checkElem(lo)
+		t.checkElem(hi)
+	}
+	if t.cmp(lo, hi) >= 0 {
+		return 0
+	}
+	first := t.ceilingNode(lo, true)
+	if first == nilNode {
+		return 0
+	}
+	end := t.ceilingNode(hi, true)
+	if first == end {
+		return 0
+	}
+
+	var removed []interface{}
+	if t.obs != nil {
+		for n := first; n != end; n = nextNode(n) {
+			removed = append(removed, n.elem)
+		}
+	}
+
+	// The comparator is not called past this point. The splits below follow
+	// each node's path from the root instead.
+	l, rest := t.split(t.root, pathTo(first))
+	var mid *node
+	if end == nilNode {
+		mid = rest
+		t.root = l
+	} else {
+		var r *node
+		mid, r = t.split(rest, pathTo(end))
+		t.root = t.join(l, end, r)
+	}
+	if t.root.color == red {
+		t.root.color = black
+	}
+	t.resetExtremes()
+
+	t.freeNode(first)
+	n := 1 + t.unlinkAll(mid)
+	t.size -= n
+	t.modCount++
+	if t.obs != nil {
+		t.notifyRemoved(removed)
+	}
+	return n
+}
+
+// RemoveIf removes every element for which pred returns true, returning the
+// number removed. pred is called once per element, in order, before the tree
+// is modified.
+//
+// Since every element must be visited anyway, the surviving nodes are relinked
+// into a balanced tree in a single O(n) pass rather than rebalancing after
+// each removal.
+func (t *RBTree) RemoveIf(pred func(interface{}) bool) int {
+	var kept, removed []*node
+	forEachNode(t.root, func(n *node) {
+		if pred(n.elem) {
+			removed = append(removed, n)
+		} else {
+			kept = append(kept, n)
+		}
+	})
+	if len(removed) == 0 {
+		return 0
+	}
+	var elems []interface{}
+	if t.obs != nil {
+		elems = make([]interface{}, len(removed))
+		for i, n := range removed {
+			elems[i] = n.elem
+		}
+	}
+	if t.hasher != nil {
+		owns := make([]uint64, len(kept))
+		for i, n := range kept {
+			owns[i] = ownSum(n)
+		}
+		for i, n := range kept {
+			n.sum = owns[i]
+		}
+	}
+	t.root = relink(kept)
+	if t.hasher != nil {
+		addChildSums(t.root)
+	}
+	t.resetExtremes()
+	for _, n := range removed {
+		t.freeNode(n)
+	}
+	t.size = len(kept)
+	t.modCount++
+	if t.obs != nil {
+		t.notifyRemoved(elems)
+	}
+	return len(removed)
+}
+
+// RetainIf removes every element for which pred returns false, returning the
+// number removed. It is otherwise the same as RemoveIf.
+func (t *RBTree) RetainIf(pred func(interface{}) bool) int {
+	return t.RemoveIf(func(elem interface{}) bool {
+		return !pred(elem)
+	})
+}
+
+// buildFrom replaces the tree's contents, which must be empty, with sorted,
+// which must be in order and free of duplicates, in O(n) time. Elements
+// beyond the tree's capacity are dropped, as if sorted were added in order.
+func (t *RBTree) buildFrom(sorted []interface{}) {
+	sorted = t.trim(sorted)
+	if len(sorted) > 0 {
+		t.inferElemType(sorted[0])
+	}
+	nodes := make([]*node, len(sorted))
+	for i, elem := range sorted {
+		nodes[i] = t.newNode(elem)
+		if t.hasher != nil {
+			nodes[i].sum = t.hash(elem)
+		}
+	}
+	t.root = relink(nodes)
+	if t.hasher != nil {
+		addChildSums(t.root)
+	}
+	t.resetExtremes()
+	t.size = len(nodes)
+	t.modCount++
+}
+
+// pathTo returns the directions from the root of n's tree down to n, with
+// true meaning left.
+func pathTo(n *node) []bool {
+	var dirs []bool
+	for ; n.parent != nilNode; n = n.parent {
+		dirs = append(dirs, n == n.parent.leftChild)
+	}
+	for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+	}
+	return dirs
+}
+
+// split detaches the node at the end of dirs from the tree rooted at n,
+// returning the roots of trees holding the elements before and after it.
+// The roots may be red.
+func (t *RBTree) split(n *node, dirs []bool) (l *node, r *node) {
+	left, right := n.leftChild, n.rightChild
+	if t.hasher != nil {
+		// A detached node's sum is its own hash, which join builds on.
+		n.sum = ownSum(n)
+	}
+	detach(left)
+	detach(right)
+	if len(dirs) == 0 {
+		return left, right
+	}
+	if dirs[0] {
+		ll, lr := t.split(left, dirs[1:])
+		return ll, t.join(lr, n, right)
+	}
+	rl, rr := t.split(right, dirs[1:])
+	return t.join(left, n, rl), rr
+}
+
+// join returns the root of a tree holding l's elements, then k's, then r's.
+// l and r must be detached roots, and k is relinked between them. The
+// returned root is black.
+func (t *RBTree) join(l *node, k *node, r *node) *node {
+	if l.color == red {
+		l.color = black
+	}
+	if r.color == red {
+		r.color = black
+	}
+	lh, rh := blackHeight(l), blackHeight(r)
+	k.color = red
+	k.parent = nilNode
+
+	if lh == rh {
+		if t.hasher != nil {
+			k.sum += l.sum + r.sum
+		}
+		k.leftChild, k.rightChild = l, r
+		setParent(l, k)
+		setParent(r, k)
+		k.color = black
+		return k
+	}
+
+	// Walk down the spine of the taller tree facing the other to the first
+	// black node of the shorter tree's height, and put k in its place. k may
+	// now be a red child of a red node, which an insert fixup resolves.
+	sub := t.sub(l)
+	if lh > rh {
+		parent, curr, h := nilNode, l, lh
+		for curr.color == red || h > rh {
+			if curr.color == black {
+				h--
+			}
+			parent, curr = curr, curr.rightChild
+		}
+		k.leftChild, k.rightChild, k.parent = curr, r, parent
+		parent.rightChild = k
+		if t.hasher != nil {
+			addSum(parent, k.sum+r.sum)
+			k.sum += curr.sum + r.sum
+		}
+	} else {
+		sub.root = r
+		parent, curr, h := nilNode, r, rh
+		for curr.color == red || h > lh {
+			if curr.color == black {
+				h--
+			}
+			parent, curr = curr, curr.leftChild
+		}
+		k.leftChild, k.rightChild, k.parent = l, curr, parent
+		parent.leftChild = k
+		if t.hasher != nil {
+			addSum(parent, k.sum+l.sum)
+			k.sum += l.sum + curr.sum
+		}
+	}
+	setParent(k.leftChild, k)
+	setParent(k.rightChild, k)
+	sub.rbInsertFixup(k)
+	return sub.root
+}
+
+// sub returns a tree sharing t's configuration, rooted at root, for running
+// fixups on a detached subtree.
+func (t *RBTree) sub(root *node) *RBTree {
+	return &RBTree{root: root, cmp: t.cmp, hasher: t.hasher}
+}
+
+// relink rebuilds nodes, which must be in order, into a balanced tree and
+// returns its root. Nodes on the deepest level are colored red, which keeps
+// black heights equal whether or not that level is full.
+func relink(nodes []*node) *node {
+	if len(nodes) == 0 {
+		return nilNode
+	}
+	root := relinkRange(nodes, 0, bits.Len(uint(len(nodes)))-1)
+	root.parent = nilNode
+	return root
+}
+
+func relinkRange(nodes []*node, depth int, maxDepth int) *node {
+	if len(nodes) == 0 {
+		return nilNode
+	}
+	mid := len(nodes) / 2
+	n := nodes[mid]
+	n.leftChild = relinkRange(nodes[:mid], depth+1, maxDepth)
+	n.rightChild = relinkRange(nodes[mid+1:], depth+1, maxDepth)
+	setParent(n.leftChild, n)
+	setParent(n.rightChild, n)
+	if depth == maxDepth && depth > 0 {
+		n.color = red
+	} else {
+		n.color = black
+	}
+	return n
+}
+
+// blackHeight returns the number of black nodes on any path from n down to
+// a leaf, counting n.
+func blackHeight(n *node) int {
+	h := 0
+	for ; n != nilNode; n = n.leftChild {
+		if n.color == black {
+			h++
+		}
+	}
+	return h
+}
+
+// unlinkAll frees every node in n's subtree, returning their number.
+func (t *RBTree) unlinkAll(n *node) int {
+	if n == nilNode {
+		return 0
+	}
+	count := 1 + t.unlinkAll(n.leftChild) + t.unlinkAll(n.rightChild)
+	t.freeNode(n)
+	return count
+}
+
+func forEachNode(n *node, f func(*node)) {
+	if n == nilNode {
+		return
+	}
+	forEachNode(n.leftChild, f)
+	f(n)
+	forEachNode(n.rightChild, f)
+}
+
+// detach makes n the root of its own tree. nilNode is left untouched.
+func detach(n *node) {
+	if n != nilNode {
+		n.parent = nilNode
+	}
+}
+
+// setParent sets n's parent unless n is nilNode, whose fields must never
+// change.
+func setParent(n *node, parent *node) {
+	if n != nilNode {
+		n.parent = parent
+	}
+}
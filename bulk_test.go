@@ -0,0 +1,128 @@
+package rbtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestRemoveRange(t *testing.T) {
+	cases := []struct {
+		lo, hi  int
+		removed int
+	}{
+		{10, 20, 10},
+		{0, 100, 100},
+		{-10, 5, 5},
+		{95, 200, 5},
+		{50, 50, 0},
+		{60, 40, 0},
+		{200, 300, 0},
+		{-20, -10, 0},
+		{42, 43, 1},
+	}
+	for _, c := range cases {
+		s := New(IntComparator)
+		for i := 0; i < 100; i++ {
+			s.Add(i)
+		}
+		if n := s.RemoveRange(c.lo, c.hi); n != c.removed {
+			t.Fatalf("RemoveRange(%v, %v) removed %v. Expected %v", c.lo, c.hi, n, c.removed)
+		}
+		checkInvariants(t, s)
+		for i := 0; i < 100; i++ {
+			want := i < c.lo || i >= c.hi
+			if s.Contains(i) != want {
+				t.Fatalf("RemoveRange(%v, %v): Contains(%v) = %v", c.lo, c.hi, i, !want)
+			}
+		}
+	}
+}
+
+func TestRemoveRange_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		s := New(IntComparator)
+		want := map[int]bool{}
+		for j := r.Intn(500); j > 0; j-- {
+			v := r.Intn(1000)
+			s.Add(v)
+			want[v] = true
+		}
+		lo, hi := r.Intn(1000), r.Intn(1000)
+		expected := 0
+		for v := range want {
+			if v >= lo && v < hi {
+				delete(want, v)
+				expected++
+			}
+		}
+		if n := s.RemoveRange(lo, hi); n != expected {
+			t.Fatalf("RemoveRange(%v, %v) removed %v. Expected %v", lo, hi, n, expected)
+		}
+		checkInvariants(t, s)
+		if s.Size() != len(want) {
+			t.Fatalf("Expected size %v. Got %v", len(want), s.Size())
+		}
+		s.ForEach(func(e interface{}) {
+			if !want[e.(int)] {
+				t.Fatalf("Unexpected element %v", e)
+			}
+		})
+	}
+}
+
+func TestRemoveRange_FaultInjection(t *testing.T) {
+	elems := []int{50, 20, 80, 10, 30, 70, 90, 5, 15, 25, 35}
+	for failAt := 1; ; failAt++ {
+		s := newFaultyTree(elems, failAt)
+		before := dumpTree(s)
+		err := func() (err error) {
+			defer recoverComparator(&err)
+			s.RemoveRange(12, 72)
+			return nil
+		}()
+		if err == nil {
+			break
+		}
+		if after := dumpTree(s); after != before {
+			t.Fatalf("RemoveRange failing at call %v changed tree.\nBefore: %v\nAfter:  %v",
+				failAt, before, after)
+		}
+	}
+}
+
+func TestRemoveIf(t *testing.T) {
+	for size := 0; size < 70; size++ {
+		s := New(IntComparator)
+		for i := 0; i < size; i++ {
+			s.Add(i)
+		}
+		n := s.RemoveIf(func(e interface{}) bool { return e.(int)%3 == 0 })
+		if expected := (size + 2) / 3; n != expected {
+			t.Fatalf("Removed %v of %v. Expected %v", n, size, expected)
+		}
+		checkInvariants(t, s)
+		for i := 0; i < size; i++ {
+			if s.Contains(i) == (i%3 == 0) {
+				t.Fatalf("Contains(%v) = %v", i, i%3 == 0)
+			}
+		}
+	}
+}
+
+func TestRetainIf(t *testing.T) {
+	s := New(IntComparator)
+	for i := 0; i < 20; i++ {
+		s.Add(i)
+	}
+	if n := s.RetainIf(func(e interface{}) bool { return e.(int) < 5 }); n != 15 {
+		t.Fatalf("Removed %v. Expected 15", n)
+	}
+	checkInvariants(t, s)
+	if got := s.ToSlice(); len(got) != 5 || got[4] != 4 {
+		t.Fatalf("Unexpected contents: %v", got)
+	}
+	if n := s.RetainIf(func(interface{}) bool { return true }); n != 0 {
+		t.Fatalf("Removed %v. Expected 0", n)
+	}
+}
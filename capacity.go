@@ -0,0 +1,131 @@
+package rbtree
+
+// EvictionPolicy decides what happens when a new element is added to a tree
+// which is at its capacity. See WithCapacity.
+type EvictionPolicy int
+
+const (
+	// EvictMin removes the smallest element, so the tree keeps the largest
+	// elements added. A new element smaller than all the others is rejected.
+	EvictMin EvictionPolicy = iota
+
+	// EvictMax removes the largest element, so the tree keeps the smallest
+	// elements added. A new element larger than all the others is rejected.
+	EvictMax
+
+	// RejectNew leaves the tree unchanged, so it keeps the first elements
+	// added.
+	RejectNew
+)
+
+// WithCapacity limits the tree to n elements. Adding an element equal to one
+// already present replaces it as usual, but adding a new element to a full
+// tree either evicts an element or rejects the new one, as policy says. If n
+// is less than 1, a capacity of 1 is used.
+//
+// Offer reports what was evicted. Evictions are also reported to OnRemove
+// callbacks and watchers, after the new element is reported as added.
+func WithCapacity(n int, policy EvictionPolicy) Option {
+	if n < 1 {
+		n = 1
+	}
+	return func(t *RBTree) {
+		t.capacity = n
+		t.policy = policy
+	}
+}
+
+// Capacity returns the tree's capacity, or 0 if it has none.
+func (t *RBTree) Capacity() int {
+	return t.capacity
+}
+
+// AddResult describes the outcome of Offer.
+type AddResult struct {
+	// Added is set if the element is now in the tree. It's false only if the
+	// tree was full and the element was rejected.
+	Added bool
+
+	// Replaced is set if the element replaced the equal element Old.
+	Replaced bool
+	Old      interface{}
+
+	// Evicted is set if Victim was removed to make room for the element.
+	Evicted bool
+	Victim  interface{}
+}
+
+// Offer adds elem to the tree as Add does, and reports whether it was added,
+// and which element was replaced or evicted, if any.
+func (t *RBTree) Offer(elem interface{}) AddResult {
+	if t.typed {
+		t.checkElem(elem)
+	}
+	n, parent, cmp := t.search(elem)
+	if n != nilNode {
+		return AddResult{Added: true, Replaced: true, Old: t.replaceElem(n, elem)}
+	}
+
+	// The comparator is not called past this point, so a panic inside it
+	// always leaves the tree unchanged.
+	victim, ok := t.admit(parent, cmp)
+	if !ok {
+		return AddResult{}
+	}
+	if victim == nilNode {
+		t.insertAt(elem, parent, cmp)
+		return AddResult{Added: true}
+	}
+	r := AddResult{Added: true, Evicted: true, Victim: victim.elem}
+	t.insertEvicting(elem, parent, cmp, victim)
+	return r
+}
+
+// admit returns whether a new element may be linked in as the child of parent
+// on the side given by cmp, as found by search, and the node to remove once it
+// is, or nilNode if there's room for it.
+func (t *RBTree) admit(parent *node, cmp int) (victim *node, ok bool) {
+	if t.capacity == 0 || t.size < t.capacity {
+		return nilNode, true
+	}
+	// As in linkAt, the new element would be the smallest only if it's the
+	// left child of the smallest node, and likewise for the largest.
+	switch t.policy {
+	case EvictMin:
+		if parent == t.min && cmp < 0 {
+			return nilNode, false
+		}
+		return t.min, true
+	case EvictMax:
+		if parent == t.max && cmp > 0 {
+			return nilNode, false
+		}
+		return t.max, true
+	}
+	return nilNode, false
+}
+
+// insertEvicting links elem in as insertAt does, and then removes victim, as
+// returned by admit, unless it's nilNode. Events are held until both are
+// done, so that observers never see the tree over its capacity.
+func (t *RBTree) insertEvicting(elem interface{}, parent *node, cmp int, victim *node) *node {
+	if victim == nilNode {
+		return t.insertAt(elem, parent, cmp)
+	}
+	defer t.releaseEvents(t.holdEvents())
+	n := t.insertAt(elem, parent, cmp)
+	t.removeNode(victim)
+	return n
+}
+
+// trim returns the elements of sorted, which is in order, that a tree with
+// the capacity and policy of t would keep if they were added in order.
+func (t *RBTree) trim(sorted []interface{}) []interface{} {
+	if t.capacity == 0 || len(sorted) <= t.capacity {
+		return sorted
+	}
+	if t.policy == EvictMin {
+		return sorted[len(sorted)-t.capacity:]
+	}
+	return sorted[:t.capacity]
+}
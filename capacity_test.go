@@ -0,0 +1,162 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCapacity_TopK(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, policy := range []EvictionPolicy{EvictMin, EvictMax} {
+		s := New(IntComparator, WithCapacity(10, policy))
+		seen := map[int]bool{}
+		for i := 0; i < 2000; i++ {
+			x := r.Intn(500)
+			seen[x] = true
+			s.Add(x)
+			if s.Size() > 10 {
+				t.Fatalf("Expected at most 10 elements. Got %v", s.Size())
+			}
+		}
+		checkInvariants(t, s)
+		var all []int
+		for x := range seen {
+			all = append(all, x)
+		}
+		sort.Ints(all)
+		if policy == EvictMin {
+			all = all[len(all)-10:]
+		} else {
+			all = all[:10]
+		}
+		var want []interface{}
+		for _, x := range all {
+			want = append(want, x)
+		}
+		if !reflect.DeepEqual(s.ToSlice(), want) {
+			t.Fatalf("Policy %v: expected %v. Got %v", policy, want, s.ToSlice())
+		}
+	}
+}
+
+func TestCapacity_Offer(t *testing.T) {
+	s := New(keyedComparator, WithCapacity(3, EvictMin))
+	for i := 1; i <= 3; i++ {
+		if r := s.Offer(keyed{i, "a"}); r != (AddResult{Added: true}) {
+			t.Fatalf("Unexpected result %+v", r)
+		}
+	}
+	if r := s.Offer(keyed{2, "b"}); r != (AddResult{Added: true, Replaced: true, Old: keyed{2, "a"}}) {
+		t.Fatalf("Expected a replacement. Got %+v", r)
+	}
+	if r := s.Offer(keyed{4, "a"}); r != (AddResult{Added: true, Evicted: true, Victim: keyed{1, "a"}}) {
+		t.Fatalf("Expected an eviction. Got %+v", r)
+	}
+	if r := s.Offer(keyed{0, "a"}); r != (AddResult{}) {
+		t.Fatalf("Expected a rejection. Got %+v", r)
+	}
+	want := []interface{}{keyed{2, "b"}, keyed{3, "a"}, keyed{4, "a"}}
+	if !reflect.DeepEqual(s.ToSlice(), want) {
+		t.Fatalf("Expected %v. Got %v", want, s.ToSlice())
+	}
+}
+
+func TestCapacity_RejectNew(t *testing.T) {
+	s := New(IntComparator, WithCapacity(3, RejectNew))
+	var removed []interface{}
+	s.OnRemove(func(elem interface{}) {
+		removed = append(removed, elem)
+	})
+	for i := 0; i < 3; i++ {
+		s.Add(i)
+	}
+	if r := s.Offer(3); r.Added {
+		t.Fatal("Expected 3 to be rejected.")
+	}
+	if actual, loaded := s.GetOrAdd(4); actual != nil || loaded {
+		t.Fatalf("Expected nil and false. Got %v and %v", actual, loaded)
+	}
+	if s.AddIfAbsent(5) {
+		t.Fatal("Expected AddIfAbsent to report 5 as rejected.")
+	}
+	if s.AddIfAbsent(1) {
+		t.Fatal("Expected AddIfAbsent to report 1 as present.")
+	}
+	if h := s.AddHandle(6); h.Valid() {
+		t.Fatal("Expected the zero handle for a rejected element.")
+	}
+	if _, ok := s.Compute(7, func(interface{}, bool) (interface{}, bool) { return 7, true }); ok {
+		t.Fatal("Expected Compute to report 7 as rejected.")
+	}
+	if !reflect.DeepEqual(s.ToSlice(), ints(0, 3, 1)) || removed != nil {
+		t.Fatalf("Expected %v unchanged. Got %v", ints(0, 3, 1), s.ToSlice())
+	}
+	s.Remove(0)
+	if !s.AddIfAbsent(5) {
+		t.Fatal("Expected 5 to be added once there was room.")
+	}
+}
+
+func TestCapacity_EvictionObserved(t *testing.T) {
+	s := New(IntComparator, WithCapacity(2, EvictMax))
+	var events []Event
+	s.OnAdd(func(elem interface{}) {
+		events = append(events, Event{Kind: Added, Elem: elem})
+	})
+	s.OnRemove(func(elem interface{}) {
+		events = append(events, Event{Kind: Removed, Elem: elem})
+	})
+	s.GetOrAdd(5)
+	s.AddHandle(3)
+	s.Compute(1, func(interface{}, bool) (interface{}, bool) { return 1, true })
+	want := []Event{
+		{Kind: Added, Elem: 5},
+		{Kind: Added, Elem: 3},
+		{Kind: Added, Elem: 1},
+		{Kind: Removed, Elem: 5},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("Expected %v. Got %v", want, events)
+	}
+}
+
+func TestCapacity_CallbackSeesEviction(t *testing.T) {
+	s := New(IntComparator, WithCapacity(2, EvictMin))
+	s.Add(1)
+	s.Add(2)
+	var sizes []int
+	var sawVictim bool
+	s.OnAdd(func(elem interface{}) {
+		sizes = append(sizes, s.Size())
+		sawVictim = sawVictim || s.Contains(elem.(int)-2)
+	})
+	s.Add(3)
+	s.TryAdd(4)
+	s.Offer(5)
+	s.GetOrAdd(6)
+	s.AddHandle(7)
+	s.Compute(8, func(interface{}, bool) (interface{}, bool) { return 8, true })
+	if want := []int{2, 2, 2, 2, 2, 2}; !reflect.DeepEqual(sizes, want) {
+		t.Fatalf("Expected sizes %v. Got %v", want, sizes)
+	}
+	if sawVictim {
+		t.Fatal("Expected the victim to be gone when OnAdd ran.")
+	}
+}
+
+func TestCapacity_Thaw(t *testing.T) {
+	s := New(IntComparator)
+	for i := 0; i < 10; i++ {
+		s.Add(i)
+	}
+	thawed := s.Freeze().Thaw(WithCapacity(4, EvictMin))
+	checkInvariants(t, thawed)
+	if !reflect.DeepEqual(thawed.ToSlice(), ints(6, 10, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(6, 10, 1), thawed.ToSlice())
+	}
+	if thawed.Capacity() != 4 {
+		t.Fatalf("Expected capacity 4. Got %v", thawed.Capacity())
+	}
+}
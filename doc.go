@@ -11,14 +11,14 @@
 //        )
 //
 //        func main() {
-//                tree := rbTree.New(rbTree.IntComparator)
+//                tree := rbtree.New(rbtree.IntComparator)
 //                tree.Add(100)
 //                tree.Add(50)
 //                tree.Add(150)
-//                first := tree.First()
-//                last := tree.Last()
+//                first, _ := tree.First()
+//                last, _ := tree.Last()
 //                containsHundred := tree.Contains(100)
-//                removedHundred := tree.Remove(100)
+//                _, removedHundred := tree.Remove(100)
 //                size := tree.Size()
 //                isEmpty := tree.IsEmpty()
 //                tree.ForEach(func(elem interface{}) { fmt.Println(elem); })
@@ -31,4 +31,6 @@
 //                fmt.Println("Empty?: ", isEmpty)
 //        }
 //        
+//
+// See MIGRATING.md for the changes made to Add, Remove, First and Last in v2.
 package rbtree
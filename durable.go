@@ -0,0 +1,544 @@
+package rbtree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Codec converts elements to and from bytes for a DurableTree. Unlike a
+// KeyCodec, its encodings may vary in length and needn't preserve order.
+type Codec interface {
+	Marshal(elem interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// FixedWidth returns a Codec which encodes elements with k.
+func FixedWidth(k KeyCodec) Codec {
+	return fixedWidth{k}
+}
+
+type fixedWidth struct {
+	k KeyCodec
+}
+
+func (c fixedWidth) Marshal(elem interface{}) ([]byte, error) {
+	data := make([]byte, c.k.Width())
+	c.k.Encode(data, elem)
+	return data, nil
+}
+
+func (c fixedWidth) Unmarshal(data []byte) (interface{}, error) {
+	if len(data) != c.k.Width() {
+		return nil, fmt.Errorf("rbtree: got %d bytes for key of width %d", len(data), c.k.Width())
+	}
+	return c.k.Decode(data), nil
+}
+
+// ErrClosed is returned when mutating a DurableTree that has been closed.
+var ErrClosed = errors.New("rbtree: durable tree is closed")
+
+// ErrCorruptSnapshot is returned when opening a DurableTree whose snapshot
+// fails its checksums.
+var ErrCorruptSnapshot = errors.New("rbtree: corrupt snapshot")
+
+// ErrCorruptLog is returned when opening a DurableTree whose log holds a
+// record which fails a checksum, followed by more data. Only the last
+// record can be torn by a crash, so the records after it can't be trusted to
+// be the only ones lost.
+var ErrCorruptLog = errors.New("rbtree: corrupt log")
+
+// A DurableTree's directory holds a snapshot file and a log file. Both are
+// sequences of records, each of which is:
+//
+//	hcrc    uint32, the CRC-32C of length and op
+//	length  uint32, the length of payload
+//	op      byte
+//	crc     uint32, the CRC-32C of payload
+//	payload [length]byte
+//
+// The header has its own checksum so that a corrupt length is never trusted
+// to say where the record ends.
+//
+// The snapshot starts with a header of snapshotHeaderSize bytes:
+//
+//	magic   [4]byte "RBSN"
+//	version uint32
+//	count   uint64, the number of records following
+//
+// and holds an opAdd record for each element. The log holds the Adds and
+// Removes made since the snapshot was taken. All integers are big-endian.
+const (
+	snapshotName       = "snapshot"
+	snapshotTempName   = "snapshot.tmp"
+	logName            = "log"
+	snapshotMagic      = "RBSN"
+	snapshotVersion    = 1
+	snapshotHeaderSize = 16
+	recordHeaderSize   = 13
+	maxRecordLength    = 1 << 30
+
+	opAdd    = 1
+	opRemove = 2
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errTornRecord is returned by readRecord for a record cut short by the end
+// of its input, and errBadRecord for one which fails either checksum or has
+// an impossible length.
+var (
+	errTornRecord = errors.New("rbtree: torn record")
+	errBadRecord  = errors.New("rbtree: bad record")
+)
+
+// DurableTree is an RBTree whose changes are recorded in a write-ahead log
+// before they are made, so that its contents survive a crash. Each Add and
+// Remove is synced to disk before it returns.
+//
+// Opening a DurableTree loads its snapshot and replays its log. A crash part
+// way through appending to the log leaves a torn record at its end, which is
+// discarded, losing only the change that was in progress. A bad record
+// anywhere else is reported as ErrCorruptLog rather than discarding the
+// changes after it. Compact replaces the snapshot with the tree's current
+// contents and empties the log.
+//
+// A DurableTree is not safe for concurrent use, and only one may be open on a
+// directory at a time.
+type DurableTree struct {
+	tree  *RBTree
+	codec Codec
+	dir   string
+
+	log     *os.File
+	logSize int64
+	records int
+
+	// compactAt, if positive, is the number of log records that triggers a
+	// Compact.
+	compactAt int
+
+	// err is set when a failed write may have left the log in an unknown
+	// state, after which no more changes are accepted.
+	err error
+}
+
+// OpenDurable opens the DurableTree stored in dir, creating the directory if
+// it doesn't exist. The tree is created with New(cmp, opts...) and elements
+// are stored using codec.
+//
+// opts may not include WithCapacity, since evictions would make replaying
+// the log over a newer snapshot, as after an interrupted Compact, change the
+// tree's contents.
+func OpenDurable(dir string, cmp Comparator, codec Codec, opts ...Option) (*DurableTree, error) {
+	tree := New(cmp, opts...)
+	if tree.capacity != 0 {
+		return nil, errors.New("rbtree: DurableTree doesn't support WithCapacity")
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	// A leftover temporary snapshot is from a Compact that didn't finish.
+	if err := os.Remove(filepath.Join(dir, snapshotTempName)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	d := &DurableTree{
+		tree:  tree,
+		codec: codec,
+		dir:   dir,
+	}
+	if err := d.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := d.replayLog(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DurableTree) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(d.dir, snapshotName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var header [snapshotHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:4]) != snapshotMagic {
+		return ErrCorruptSnapshot
+	}
+	if v := binary.BigEndian.Uint32(header[4:]); v != snapshotVersion {
+		return fmt.Errorf("rbtree: unsupported snapshot version %d", v)
+	}
+	count := binary.BigEndian.Uint64(header[8:])
+	for i := uint64(0); i < count; i++ {
+		op, payload, _, err := readRecord(r)
+		if err != nil || op != opAdd {
+			return ErrCorruptSnapshot
+		}
+		if err := d.apply(op, payload); err != nil {
+			return err
+		}
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return ErrCorruptSnapshot
+	}
+	return nil
+}
+
+// replayLog applies the log's records to the tree, truncating any torn record
+// from its end, and leaves the log open for appending.
+func (d *DurableTree) replayLog() error {
+	f, err := os.OpenFile(filepath.Join(d.dir, logName), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r := bufio.NewReader(f)
+	var size int64
+	for {
+		op, payload, n, err := readRecord(r)
+		if err == errBadRecord {
+			// A bad record is torn only if it's the last, reaching the
+			// end of the file.
+			if size+int64(n) >= fi.Size() {
+				err = errTornRecord
+			} else {
+				err = ErrCorruptLog
+			}
+		}
+		if err == io.EOF || err == errTornRecord {
+			break
+		}
+		if err == nil {
+			err = d.apply(op, payload)
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+		size += int64(n)
+		d.records++
+	}
+	if fi.Size() != size {
+		err := f.Truncate(size)
+		if err == nil {
+			err = f.Sync()
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	d.log = f
+	d.logSize = size
+	return nil
+}
+
+// apply makes the change described by a log record to the tree. Since the
+// log may be replayed over a snapshot which already includes some of its
+// records, as when a crash interrupts Compact, applying a record must be
+// idempotent. Adds and Removes are.
+func (d *DurableTree) apply(op byte, payload []byte) error {
+	elem, err := d.codec.Unmarshal(payload)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case opAdd:
+		_, _, err = d.tree.TryAdd(elem)
+	case opRemove:
+		_, _, err = d.tree.TryRemove(elem)
+	default:
+		err = fmt.Errorf("rbtree: unknown log operation %d", op)
+	}
+	return err
+}
+
+// Add logs elem's addition and then adds it to the tree, as RBTree.Add does.
+// If the change can't be logged, or the comparator panics, an error is
+// returned and the tree is unchanged.
+func (d *DurableTree) Add(elem interface{}) (old interface{}, replaced bool, err error) {
+	size, err := d.append(opAdd, elem)
+	if err != nil {
+		return nil, false, err
+	}
+	old, replaced, err = d.tree.TryAdd(elem)
+	if err != nil {
+		// The comparator panicked, so the record must not be replayed.
+		d.truncate(size)
+		return nil, false, err
+	}
+	return old, replaced, d.maybeCompact()
+}
+
+// Remove logs elem's removal and then removes it from the tree, as
+// RBTree.Remove does. Nothing is logged if elem isn't in the tree. If the
+// change can't be logged, or the comparator panics, an error is returned and
+// the tree is unchanged.
+func (d *DurableTree) Remove(elem interface{}) (removed interface{}, ok bool, err error) {
+	if d.err != nil {
+		return nil, false, d.err
+	}
+	if _, found, err := d.tree.TryGet(elem); err != nil || !found {
+		return nil, false, err
+	}
+	if _, err := d.append(opRemove, elem); err != nil {
+		return nil, false, err
+	}
+	removed, ok = d.tree.Remove(elem)
+	return removed, ok, d.maybeCompact()
+}
+
+// append writes a record to the end of the log and syncs it, returning the
+// log's size before the write.
+func (d *DurableTree) append(op byte, elem interface{}) (int64, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	payload, err := d.codec.Marshal(elem)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) > maxRecordLength {
+		return 0, fmt.Errorf("rbtree: encoded element of %d bytes is too large", len(payload))
+	}
+	rec := appendRecord(nil, op, payload)
+	size := d.logSize
+	if _, err := d.log.WriteAt(rec, size); err != nil {
+		d.truncate(size)
+		return 0, err
+	}
+	if err := d.log.Sync(); err != nil {
+		// The record may or may not have reached the disk.
+		d.err = err
+		return 0, err
+	}
+	d.logSize += int64(len(rec))
+	d.records++
+	return size, nil
+}
+
+// truncate removes everything past size from the log. If that fails, the log
+// may end in a record that doesn't match the tree, so d is marked as failed.
+func (d *DurableTree) truncate(size int64) {
+	err := d.log.Truncate(size)
+	if err == nil {
+		err = d.log.Sync()
+	}
+	if err != nil {
+		d.err = err
+		return
+	}
+	if d.logSize != size {
+		d.logSize = size
+		d.records--
+	}
+}
+
+// SetAutoCompact makes the tree Compact itself whenever its log reaches the
+// given number of records. A value of 0 or less turns automatic compaction
+// off, which is the default.
+//
+// An error from an automatic Compact is returned by the Add or Remove that
+// triggered it, whose change has been made and logged regardless.
+func (d *DurableTree) SetAutoCompact(records int) {
+	d.compactAt = records
+}
+
+func (d *DurableTree) maybeCompact() error {
+	if d.compactAt > 0 && d.records >= d.compactAt {
+		return d.Compact()
+	}
+	return nil
+}
+
+// Compact writes the tree's contents to a new snapshot, which atomically
+// replaces the old one, and then empties the log. It takes O(n) time.
+func (d *DurableTree) Compact() error {
+	if d.err != nil {
+		return d.err
+	}
+	temp := filepath.Join(d.dir, snapshotTempName)
+	if err := d.writeSnapshot(temp); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err := os.Rename(temp, filepath.Join(d.dir, snapshotName)); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err := syncDir(d.dir); err != nil {
+		return err
+	}
+	// A crash before the log is emptied replays it over the new snapshot,
+	// which apply allows.
+	d.truncate(0)
+	if d.err != nil {
+		return d.err
+	}
+	d.records = 0
+	return nil
+}
+
+func (d *DurableTree) writeSnapshot(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	var header [snapshotHeaderSize]byte
+	copy(header[:], snapshotMagic)
+	binary.BigEndian.PutUint32(header[4:], snapshotVersion)
+	binary.BigEndian.PutUint64(header[8:], uint64(d.tree.Size()))
+	w.Write(header[:])
+	var rec []byte
+	for n := d.tree.min; n != nilNode; n = nextNode(n) {
+		payload, err := d.codec.Marshal(n.elem)
+		if err != nil {
+			return err
+		}
+		rec = appendRecord(rec[:0], opAdd, payload)
+		w.Write(rec)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir syncs the directory dir, so that a rename within it is durable.
+// Not every platform supports syncing directories, so failure to sync is
+// ignored.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	f.Sync()
+	return f.Close()
+}
+
+// Close closes the tree's log. The tree can't be changed after it is closed.
+func (d *DurableTree) Close() error {
+	if d.log == nil {
+		return ErrClosed
+	}
+	err := d.log.Close()
+	d.log = nil
+	if d.err == nil {
+		d.err = ErrClosed
+	}
+	return err
+}
+
+// Contains returns whether elem is in the tree.
+func (d *DurableTree) Contains(elem interface{}) bool {
+	return d.tree.Contains(elem)
+}
+
+// Get returns the element equal to probe, or (nil, false) if none exists.
+func (d *DurableTree) Get(probe interface{}) (interface{}, bool) {
+	return d.tree.Get(probe)
+}
+
+// First returns the tree's smallest element or (nil, false) if it is empty.
+func (d *DurableTree) First() (interface{}, bool) {
+	return d.tree.First()
+}
+
+// Last returns the tree's largest element or (nil, false) if it is empty.
+func (d *DurableTree) Last() (interface{}, bool) {
+	return d.tree.Last()
+}
+
+// Size returns the number of elements in the tree.
+func (d *DurableTree) Size() int {
+	return d.tree.Size()
+}
+
+// IsEmpty returns whether the tree is empty.
+func (d *DurableTree) IsEmpty() bool {
+	return d.tree.IsEmpty()
+}
+
+// ForEach iterates over the tree's elements in sorted order, calling f on
+// each. f must not change the tree.
+func (d *DurableTree) ForEach(f func(interface{})) {
+	d.tree.ForEach(f)
+}
+
+// ToSlice returns the tree's elements in a sorted slice.
+func (d *DurableTree) ToSlice() []interface{} {
+	return d.tree.ToSlice()
+}
+
+// String returns a string representation of the tree, as RBTree.String does.
+func (d *DurableTree) String() string {
+	return d.tree.String()
+}
+
+func appendRecord(buf []byte, op byte, payload []byte) []byte {
+	start := len(buf)
+	buf = append(buf, 0, 0, 0, 0, 0, 0, 0, 0, op, 0, 0, 0, 0)
+	h := buf[start:]
+	binary.BigEndian.PutUint32(h[4:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(h, crc32.Checksum(h[4:9], castagnoli))
+	binary.BigEndian.PutUint32(h[9:], crc32.Checksum(payload, castagnoli))
+	return append(buf, payload...)
+}
+
+// readRecord reads the next record from r, returning its length in bytes. It
+// returns io.EOF if r is at its end, and errTornRecord if the record is
+// incomplete. It returns errBadRecord if the record fails either checksum or
+// is too long, with the length the record claims if its header is intact,
+// and the header's length otherwise.
+func readRecord(r *bufio.Reader) (op byte, payload []byte, n int, err error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return 0, nil, 0, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = errTornRecord
+		}
+		return 0, nil, 0, err
+	}
+	if crc32.Checksum(header[4:9], castagnoli) != binary.BigEndian.Uint32(header[:4]) {
+		return 0, nil, recordHeaderSize, errBadRecord
+	}
+	length := binary.BigEndian.Uint32(header[4:])
+	n = recordHeaderSize + int(length)
+	if length > maxRecordLength {
+		return 0, nil, n, errBadRecord
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// The header is intact, so the record really does run past
+			// the end.
+			err = errTornRecord
+		}
+		return 0, nil, 0, err
+	}
+	if crc32.Checksum(payload, castagnoli) != binary.BigEndian.Uint32(header[9:]) {
+		return 0, nil, n, errBadRecord
+	}
+	return header[8], payload, n, nil
+}
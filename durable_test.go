@@ -0,0 +1,282 @@
+package rbtree
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var durableInts = FixedWidth(IntKeys)
+
+func openDurable(t *testing.T, dir string) *DurableTree {
+	d, err := OpenDurable(dir, IntComparator, durableInts)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return d
+}
+
+func TestDurable_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	for i := 0; i < 100; i++ {
+		d.Add(i)
+	}
+	for i := 0; i < 100; i += 3 {
+		if _, ok, err := d.Remove(i); !ok || err != nil {
+			t.Fatalf("Expected to remove %v. Got %v, %v", i, ok, err)
+		}
+	}
+	if _, ok, _ := d.Remove(1000); ok {
+		t.Fatal("Removed element not in tree.")
+	}
+	want := d.ToSlice()
+	d.Close()
+	d = openDurable(t, dir)
+	defer d.Close()
+	if !reflect.DeepEqual(d.ToSlice(), want) {
+		t.Fatalf("Expected %v. Got %v", want, d.ToSlice())
+	}
+	checkInvariants(t, d.tree)
+}
+
+// TestDurable_TruncatedLog simulates a crash at every byte of the log, by
+// reopening the tree with the log cut short there.
+func TestDurable_TruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		d.Add(r.Intn(30))
+	}
+	d.Compact()
+	// The contents of the tree after each whole record in the log.
+	states := [][]interface{}{d.ToSlice()}
+	offsets := []int64{0}
+	for i := 0; i < 30; i++ {
+		if r.Intn(2) == 0 {
+			d.Add(r.Intn(30))
+		} else if _, ok, _ := d.Remove(r.Intn(30)); !ok {
+			continue
+		}
+		states = append(states, d.ToSlice())
+		offsets = append(offsets, d.logSize)
+	}
+	d.Close()
+	snapshot, _ := os.ReadFile(filepath.Join(dir, snapshotName))
+	log, _ := os.ReadFile(filepath.Join(dir, logName))
+	if int64(len(log)) != offsets[len(offsets)-1] {
+		t.Fatalf("Expected log of %v bytes. Got %v", offsets[len(offsets)-1], len(log))
+	}
+	record := 0
+	for cut := 0; cut <= len(log); cut++ {
+		for record+1 < len(offsets) && offsets[record+1] <= int64(cut) {
+			record++
+		}
+		crashed := t.TempDir()
+		os.WriteFile(filepath.Join(crashed, snapshotName), snapshot, 0666)
+		os.WriteFile(filepath.Join(crashed, logName), log[:cut], 0666)
+		d := openDurable(t, crashed)
+		if !reflect.DeepEqual(d.ToSlice(), states[record]) {
+			t.Fatalf("Cut at %v: expected %v. Got %v", cut, states[record], d.ToSlice())
+		}
+		if d.logSize != offsets[record] {
+			t.Fatalf("Cut at %v: expected log truncated to %v. Got %v", cut, offsets[record], d.logSize)
+		}
+		// The torn record must be gone, so that later records are replayed.
+		d.Add(-1)
+		d.Close()
+		d = openDurable(t, crashed)
+		if !d.Contains(-1) || d.Size() != len(states[record])+1 {
+			t.Fatalf("Cut at %v: record appended after recovery was lost.", cut)
+		}
+		d.Close()
+	}
+}
+
+func TestDurable_CorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	for i := 0; i < 10; i++ {
+		d.Add(i)
+	}
+	d.Close()
+	name := filepath.Join(dir, logName)
+	log, _ := os.ReadFile(name)
+	// Corrupting the sixth record's payload can't be a torn write, since
+	// records follow it.
+	bad := append([]byte(nil), log...)
+	bad[5*(recordHeaderSize+8)+recordHeaderSize] ^= 1
+	os.WriteFile(name, bad, 0666)
+	if _, err := OpenDurable(dir, IntComparator, durableInts); err != ErrCorruptLog {
+		t.Fatalf("Expected %v. Got %v", ErrCorruptLog, err)
+	}
+	if got, _ := os.ReadFile(name); !reflect.DeepEqual(got, bad) {
+		t.Fatal("Expected the corrupt log to be left as it was.")
+	}
+
+	// Nor can a corrupt length, which must not be trusted to say where the
+	// record ends.
+	bad = append([]byte(nil), log...)
+	binary.BigEndian.PutUint32(bad[2*(recordHeaderSize+8)+4:], 1000)
+	os.WriteFile(name, bad, 0666)
+	if _, err := OpenDurable(dir, IntComparator, durableInts); err != ErrCorruptLog {
+		t.Fatalf("Expected %v. Got %v", ErrCorruptLog, err)
+	}
+	if got, _ := os.ReadFile(name); !reflect.DeepEqual(got, bad) {
+		t.Fatal("Expected the log with a corrupt length to be left as it was.")
+	}
+
+	// Corrupting the last record's payload is, and loses only that record.
+	log[9*(recordHeaderSize+8)+recordHeaderSize] ^= 1
+	os.WriteFile(name, log, 0666)
+	d = openDurable(t, dir)
+	defer d.Close()
+	if !reflect.DeepEqual(d.ToSlice(), ints(0, 9, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(0, 9, 1), d.ToSlice())
+	}
+}
+
+func TestDurable_InterruptedCompact(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	for i := 0; i < 50; i++ {
+		d.Add(i)
+	}
+	for i := 0; i < 50; i += 2 {
+		d.Remove(i)
+	}
+	want := d.ToSlice()
+	log, _ := os.ReadFile(filepath.Join(dir, logName))
+	if err := d.Compact(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	d.Close()
+	if fi, _ := os.Stat(filepath.Join(dir, logName)); fi.Size() != 0 {
+		t.Fatalf("Expected empty log after Compact. Got %v bytes", fi.Size())
+	}
+
+	// A crash after the new snapshot is in place, but before the log is
+	// emptied, leaves the old log alongside the new snapshot. A crash while
+	// writing the snapshot leaves a partial temporary file.
+	os.WriteFile(filepath.Join(dir, logName), log, 0666)
+	os.WriteFile(filepath.Join(dir, snapshotTempName), []byte("RBSN\x00"), 0666)
+	d = openDurable(t, dir)
+	defer d.Close()
+	if !reflect.DeepEqual(d.ToSlice(), want) {
+		t.Fatalf("Expected %v. Got %v", want, d.ToSlice())
+	}
+	if _, err := os.Stat(filepath.Join(dir, snapshotTempName)); !os.IsNotExist(err) {
+		t.Fatal("Expected temporary snapshot to be removed.")
+	}
+}
+
+func TestDurable_Capacity(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	d.Add(1)
+	d.Add(2)
+	d.Remove(2)
+	d.Add(3)
+	log, _ := os.ReadFile(filepath.Join(dir, logName))
+	if err := d.Compact(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	d.Close()
+
+	// Replaying the log over the new snapshot with a capacity of 2 would
+	// evict 1 to make room for 2 again.
+	os.WriteFile(filepath.Join(dir, logName), log, 0666)
+	if _, err := OpenDurable(dir, IntComparator, durableInts, WithCapacity(2, EvictMin)); err == nil {
+		t.Fatal("Expected OpenDurable to reject WithCapacity.")
+	}
+	d = openDurable(t, dir)
+	defer d.Close()
+	if !reflect.DeepEqual(d.ToSlice(), []interface{}{1, 3}) {
+		t.Fatalf("Expected [1 3]. Got %v", d.ToSlice())
+	}
+}
+
+func TestDurable_CorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	for i := 0; i < 10; i++ {
+		d.Add(i)
+	}
+	d.Compact()
+	d.Close()
+	name := filepath.Join(dir, snapshotName)
+	snapshot, _ := os.ReadFile(name)
+	snapshot[len(snapshot)-1] ^= 1
+	os.WriteFile(name, snapshot, 0666)
+	if _, err := OpenDurable(dir, IntComparator, durableInts); err != ErrCorruptSnapshot {
+		t.Fatalf("Expected %v. Got %v", ErrCorruptSnapshot, err)
+	}
+}
+
+func TestDurable_AutoCompact(t *testing.T) {
+	dir := t.TempDir()
+	d := openDurable(t, dir)
+	d.SetAutoCompact(10)
+	for i := 0; i < 25; i++ {
+		if _, _, err := d.Add(i); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if d.records != 5 {
+		t.Fatalf("Expected 5 records in log. Got %v", d.records)
+	}
+	d.Close()
+	d = openDurable(t, dir)
+	defer d.Close()
+	if !reflect.DeepEqual(d.ToSlice(), ints(0, 25, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(0, 25, 1), d.ToSlice())
+	}
+}
+
+func TestDurable_ComparatorPanic(t *testing.T) {
+	dir := t.TempDir()
+	cmp := func(a, b interface{}) int {
+		if a == -1 || b == -1 {
+			panic(errInjected)
+		}
+		return a.(int) - b.(int)
+	}
+	d, _ := OpenDurable(dir, cmp, durableInts)
+	d.Add(1)
+	size := d.logSize
+	if _, _, err := d.Add(-1); err == nil {
+		t.Fatal("Expected error from panicking comparator.")
+	}
+	if d.logSize != size || d.records != 1 {
+		t.Fatal("Record of failed Add was left in the log.")
+	}
+	d.Add(2)
+	d.Close()
+	d, err := OpenDurable(dir, cmp, durableInts)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer d.Close()
+	if !reflect.DeepEqual(d.ToSlice(), ints(1, 3, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(1, 3, 1), d.ToSlice())
+	}
+}
+
+func TestDurable_Closed(t *testing.T) {
+	d := openDurable(t, t.TempDir())
+	d.Add(1)
+	d.Close()
+	if _, _, err := d.Add(2); err != ErrClosed {
+		t.Fatalf("Expected %v. Got %v", ErrClosed, err)
+	}
+	if _, _, err := d.Remove(1); err != ErrClosed {
+		t.Fatalf("Expected %v. Got %v", ErrClosed, err)
+	}
+	if err := d.Close(); err != ErrClosed {
+		t.Fatalf("Expected %v. Got %v", ErrClosed, err)
+	}
+}
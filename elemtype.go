@@ -0,0 +1,68 @@
+package rbtree
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TypeError is the panic value used when an element of the wrong type is
+// given to a tree pinned with WithElemType or WithInferredElemType. The Try
+// methods return it as an error instead.
+type TypeError struct {
+	Want reflect.Type
+	Got  reflect.Type
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("rbtree: element of type %v given to tree of %v", e.Got, e.Want)
+}
+
+// WithElemType pins the tree to elements of type typ. If typ is an interface
+// type, any element implementing it is accepted.
+//
+// Mismatched elements are rejected before they reach the comparator, so the
+// mistake surfaces where it was made rather than in a later, unrelated call.
+func WithElemType(typ reflect.Type) Option {
+	return func(t *RBTree) {
+		t.typed = true
+		t.elemType = typ
+	}
+}
+
+// WithInferredElemType pins the tree to the type of the first element added
+// to it. Calls which leave the tree unchanged, such as an Add rejected by a
+// View's range or a Txn rolled back, don't pin it. Clear does not unpin the
+// tree.
+func WithInferredElemType() Option {
+	return func(t *RBTree) {
+		t.typed = true
+		t.elemType = nil
+	}
+}
+
+// checkElem panics with a *TypeError if elem does not have the tree's
+// element type. Any element is accepted while the type is yet to be inferred.
+// Callers should only call it if t.typed.
+func (t *RBTree) checkElem(elem interface{}) {
+	if t.elemType == nil {
+		return
+	}
+	got := reflect.TypeOf(elem)
+	if got == t.elemType {
+		return
+	}
+	if got != nil && t.elemType.Kind() == reflect.Interface && got.Implements(t.elemType) {
+		return
+	}
+	panic(&TypeError{Want: t.elemType, Got: got})
+}
+
+// inferElemType makes elem's type the tree's element type if the tree was
+// created with WithInferredElemType and the type is not yet known. It's called
+// as elem is linked into the tree, so that calls which leave the tree
+// unchanged don't pin it.
+func (t *RBTree) inferElemType(elem interface{}) {
+	if t.typed && t.elemType == nil {
+		t.elemType = reflect.TypeOf(elem)
+	}
+}
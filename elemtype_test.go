@@ -0,0 +1,103 @@
+package rbtree
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// expectTypeError runs f and fails unless it panics with a *TypeError.
+func expectTypeError(t *testing.T, f func()) {
+	t.Helper()
+	defer func() {
+		r := recover()
+		if _, ok := r.(*TypeError); !ok {
+			t.Fatalf("Expected *TypeError panic. Got %v", r)
+		}
+	}()
+	f()
+}
+
+func TestWithElemType_RejectsMismatch(t *testing.T) {
+	s := New(IntComparator, WithElemType(reflect.TypeOf(0)))
+	s.Add(1)
+	expectTypeError(t, func() { s.Add(int64(2)) })
+	expectTypeError(t, func() { s.Contains(int64(1)) })
+	expectTypeError(t, func() { s.Remove("1") })
+	expectTypeError(t, func() { s.Add(nil) })
+	if s.Size() != 1 || !s.Contains(1) {
+		t.Fatal("Rejected element changed tree.")
+	}
+}
+
+func TestWithElemType_EmptyTree(t *testing.T) {
+	// The comparator is never called on an empty tree, so the check must
+	// not depend on it.
+	s := New(IntComparator, WithElemType(reflect.TypeOf(0)))
+	expectTypeError(t, func() { s.Add(int64(2)) })
+	if s.Size() != 0 {
+		t.Fatal("Rejected element was added.")
+	}
+}
+
+func TestWithElemType_Interface(t *testing.T) {
+	cmp := func(a, b interface{}) int {
+		return StringComparator(a.(fmt.Stringer).String(), b.(fmt.Stringer).String())
+	}
+	s := New(cmp, WithElemType(reflect.TypeOf((*fmt.Stringer)(nil)).Elem()))
+	s.Add(reflect.TypeOf(0))
+	s.Add(reflect.TypeOf(""))
+	if s.Size() != 2 {
+		t.Fatal("Implementations of interface were rejected.")
+	}
+	expectTypeError(t, func() { s.Add(1) })
+}
+
+func TestWithInferredElemType(t *testing.T) {
+	s := New(IntComparator, WithInferredElemType())
+	if s.Contains(int64(1)) {
+		t.Fatal("Empty tree contained element.")
+	}
+	s.Add(1)
+	expectTypeError(t, func() { s.Add(int64(2)) })
+	s.Clear()
+	expectTypeError(t, func() { s.Add(int64(2)) })
+}
+
+func TestWithInferredElemType_UnchangedTree(t *testing.T) {
+	// cmp compares ints and int64s alike, so that only the type check can
+	// tell them apart.
+	cmp := func(a, b interface{}) int {
+		return Int64Comparator(reflect.ValueOf(a).Int(), reflect.ValueOf(b).Int())
+	}
+	s := New(cmp, WithInferredElemType())
+	if _, _, err := s.SubSet(0, 10, true, false).Add(int64(20)); err != ErrOutOfRange {
+		t.Fatalf("Expected %v. Got %v", ErrOutOfRange, err)
+	}
+	tx := s.Begin()
+	tx.Add(int64(1))
+	tx.Rollback()
+	s.Add(1)
+	expectTypeError(t, func() { s.Add(int64(2)) })
+
+	s = New(cmp, WithInferredElemType())
+	tx = s.Begin()
+	tx.Add(int64(1))
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expectTypeError(t, func() { s.Add(2) })
+}
+
+func TestTryAdd_TypeError(t *testing.T) {
+	s := New(IntComparator, WithElemType(reflect.TypeOf(0)))
+	_, _, err := s.TryAdd(int64(1))
+	var te *TypeError
+	if !errors.As(err, &te) {
+		t.Fatalf("Expected *TypeError. Got %v", err)
+	}
+	if te.Want != reflect.TypeOf(0) || te.Got != reflect.TypeOf(int64(0)) {
+		t.Fatalf("Unexpected types in error: %v", te)
+	}
+}
@@ -0,0 +1,224 @@
+package rbtree
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ExpiringTree is a sorted set whose elements expire a given time after they
+// are added. Expired elements are never returned: every operation first
+// evicts the elements which have expired by the tree's clock, which costs
+// O(log n) per element evicted, and only a comparison when none have. Sweep
+// evicts elements as of a given time, without reading the clock.
+//
+// Elements are held in a second tree ordered by expiry time, so an element's
+// expiry can be found and changed in O(log n) time.
+type ExpiringTree struct {
+	cmp     Comparator
+	elems   *RBTree // of *expiring, ordered by elem
+	expiry  *RBTree // of *expiring with deadlines, ordered by deadline
+	ttl     time.Duration
+	now     func() time.Time
+	onEvict func(elem interface{})
+}
+
+// expiring is an element and the time it expires, or the zero time if it
+// never does.
+type expiring struct {
+	elem     interface{}
+	deadline time.Time
+}
+
+// NewExpiring returns an empty ExpiringTree which uses the given comparator,
+// and in which elements added by Add expire ttl after they are added. If ttl
+// is 0 or less, they never expire.
+func NewExpiring(cmp Comparator, ttl time.Duration) *ExpiringTree {
+	return &ExpiringTree{
+		cmp: cmp,
+		elems: New(func(a, b interface{}) int {
+			return cmp(a.(*expiring).elem, b.(*expiring).elem)
+		}),
+		expiry: New(func(a, b interface{}) int {
+			x, y := a.(*expiring), b.(*expiring)
+			if x.deadline.Before(y.deadline) {
+				return -1
+			} else if x.deadline.After(y.deadline) {
+				return 1
+			}
+			return cmp(x.elem, y.elem)
+		}),
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// SetClock makes the tree read the current time from now rather than
+// time.Now.
+func (t *ExpiringTree) SetClock(now func() time.Time) {
+	t.now = now
+}
+
+// OnEvict sets f to be called with each element evicted because it expired,
+// once it has been removed. Elements removed by Remove or Clear, or replaced
+// by Add, are not reported. f may change the tree.
+func (t *ExpiringTree) OnEvict(f func(elem interface{})) {
+	t.onEvict = f
+}
+
+// Add adds elem to the tree, expiring after the tree's default TTL, as
+// RBTree.Add does. An expired equal element is evicted rather than replaced.
+func (t *ExpiringTree) Add(elem interface{}) (old interface{}, replaced bool) {
+	return t.AddWithTTL(elem, t.ttl)
+}
+
+// AddWithTTL adds elem to the tree as Add does, expiring ttl from now. If ttl
+// is 0 or less, elem never expires.
+func (t *ExpiringTree) AddWithTTL(elem interface{}, ttl time.Duration) (old interface{}, replaced bool) {
+	now := t.now()
+	t.Sweep(now)
+	e := &expiring{elem: elem}
+	if ttl > 0 {
+		e.deadline = now.Add(ttl)
+	}
+	prev, replaced := t.elems.Add(e)
+	if replaced {
+		p := prev.(*expiring)
+		if !p.deadline.IsZero() {
+			t.expiry.Remove(p)
+		}
+		old = p.elem
+	}
+	if !e.deadline.IsZero() {
+		t.expiry.Add(e)
+	}
+	return old, replaced
+}
+
+// Remove removes the element equal to elem, as RBTree.Remove does.
+func (t *ExpiringTree) Remove(elem interface{}) (removed interface{}, ok bool) {
+	t.Sweep(t.now())
+	r, ok := t.elems.Remove(&expiring{elem: elem})
+	if !ok {
+		return nil, false
+	}
+	e := r.(*expiring)
+	if !e.deadline.IsZero() {
+		t.expiry.Remove(e)
+	}
+	return e.elem, true
+}
+
+// Sweep evicts every element which expires at or before now, in order of
+// expiry, and returns the number evicted.
+func (t *ExpiringTree) Sweep(now time.Time) int {
+	count := 0
+	for {
+		first, ok := t.expiry.PeekMin()
+		if !ok || first.(*expiring).deadline.After(now) {
+			return count
+		}
+		e := first.(*expiring)
+		t.expiry.PopMin()
+		t.elems.Remove(e)
+		count++
+		if t.onEvict != nil {
+			t.onEvict(e.elem)
+		}
+	}
+}
+
+// Contains returns whether elem exists in the tree and hasn't expired.
+func (t *ExpiringTree) Contains(elem interface{}) bool {
+	_, found := t.Get(elem)
+	return found
+}
+
+// Get returns the element equal to probe, or (nil, false) if none exists or
+// it has expired.
+func (t *ExpiringTree) Get(probe interface{}) (interface{}, bool) {
+	t.Sweep(t.now())
+	if e, ok := t.elems.Get(&expiring{elem: probe}); ok {
+		return e.(*expiring).elem, true
+	}
+	return nil, false
+}
+
+// Expiry returns the time the element equal to probe expires, which is the
+// zero time if it never does. It returns false if no such element exists.
+func (t *ExpiringTree) Expiry(probe interface{}) (time.Time, bool) {
+	t.Sweep(t.now())
+	if e, ok := t.elems.Get(&expiring{elem: probe}); ok {
+		return e.(*expiring).deadline, true
+	}
+	return time.Time{}, false
+}
+
+// First returns the smallest element or (nil, false) if the tree is empty.
+func (t *ExpiringTree) First() (interface{}, bool) {
+	t.Sweep(t.now())
+	return elemOf(t.elems.First())
+}
+
+// Last returns the largest element or (nil, false) if the tree is empty.
+func (t *ExpiringTree) Last() (interface{}, bool) {
+	t.Sweep(t.now())
+	return elemOf(t.elems.Last())
+}
+
+func elemOf(e interface{}, ok bool) (interface{}, bool) {
+	if !ok {
+		return nil, false
+	}
+	return e.(*expiring).elem, true
+}
+
+// Size returns the number of unexpired elements in the tree.
+func (t *ExpiringTree) Size() int {
+	t.Sweep(t.now())
+	return t.elems.Size()
+}
+
+// IsEmpty returns whether the tree has no unexpired elements.
+func (t *ExpiringTree) IsEmpty() bool {
+	return t.Size() == 0
+}
+
+// ForEach calls f on each unexpired element in sorted order. Elements are
+// evicted before iteration starts, not during it, so f sees the elements as
+// of that time.
+func (t *ExpiringTree) ForEach(f func(interface{})) {
+	t.Sweep(t.now())
+	t.elems.ForEach(func(e interface{}) {
+		f(e.(*expiring).elem)
+	})
+}
+
+// ToSlice returns the tree's unexpired elements in a sorted slice.
+func (t *ExpiringTree) ToSlice() (s []interface{}) {
+	t.ForEach(func(a interface{}) {
+		s = append(s, a)
+	})
+	return
+}
+
+// Clear removes all elements without reporting them as evicted.
+func (t *ExpiringTree) Clear() {
+	t.elems.Clear()
+	t.expiry.Clear()
+}
+
+// String returns a string representation of the tree, including its size and
+// first and last elements, if they exist.
+func (t *ExpiringTree) String() string {
+	s := "ExpiringTree<"
+	s += "Size: " + strconv.Itoa(t.Size())
+	if first, exists := t.First(); exists {
+		s += ", First: " + fmt.Sprintf("%v", first)
+	}
+	if last, exists := t.Last(); exists {
+		s += ", Last: " + fmt.Sprintf("%v", last)
+	}
+	s += ">"
+	return s
+}
@@ -0,0 +1,124 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock for tests which only moves when told to.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newExpiringForTest(ttl time.Duration) (*ExpiringTree, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	t := NewExpiring(IntComparator, ttl)
+	t.SetClock(clock.now)
+	return t, clock
+}
+
+func TestExpiring_Expiry(t *testing.T) {
+	s, clock := newExpiringForTest(10 * time.Second)
+	var evicted []interface{}
+	s.OnEvict(func(elem interface{}) {
+		evicted = append(evicted, elem)
+	})
+	s.Add(1)
+	s.AddWithTTL(2, 5*time.Second)
+	s.AddWithTTL(3, 0)
+	clock.advance(5 * time.Second)
+	if s.Contains(2) {
+		t.Fatal("Element 2 should expire at exactly its deadline.")
+	}
+	if !reflect.DeepEqual(s.ToSlice(), []interface{}{1, 3}) {
+		t.Fatalf("Expected [1 3]. Got %v", s.ToSlice())
+	}
+
+	// Re-adding an element resets its expiry.
+	s.Add(1)
+	clock.advance(9 * time.Second)
+	if !s.Contains(1) {
+		t.Fatal("Expected 1's expiry to be reset.")
+	}
+	if deadline, _ := s.Expiry(1); !deadline.Equal(clock.t.Add(time.Second)) {
+		t.Fatalf("Expected expiry %v. Got %v", clock.t.Add(time.Second), deadline)
+	}
+	clock.advance(time.Hour)
+	if s.Size() != 1 || !s.Contains(3) {
+		t.Fatalf("Expected only the element without a TTL to remain. Got %v", s.ToSlice())
+	}
+	if !reflect.DeepEqual(evicted, []interface{}{2, 1}) {
+		t.Fatalf("Expected [2 1]. Got %v", evicted)
+	}
+}
+
+func TestExpiring_Sweep(t *testing.T) {
+	s, clock := newExpiringForTest(0)
+	for i := 0; i < 10; i++ {
+		s.AddWithTTL(i, time.Duration(10-i)*time.Second)
+	}
+	var evicted []interface{}
+	s.OnEvict(func(elem interface{}) {
+		evicted = append(evicted, elem)
+	})
+	if n := s.Sweep(clock.t.Add(3 * time.Second)); n != 3 {
+		t.Fatalf("Expected 3 evictions. Got %v", n)
+	}
+	if !reflect.DeepEqual(evicted, []interface{}{9, 8, 7}) {
+		t.Fatalf("Expected evictions in expiry order. Got %v", evicted)
+	}
+	s.Remove(0)
+	if n := s.Sweep(clock.t.Add(time.Hour)); n != 6 {
+		t.Fatalf("Expected removed elements not to be evicted. Got %v evictions", n)
+	}
+	if !s.IsEmpty() {
+		t.Fatalf("Expected empty tree. Got %v", s)
+	}
+}
+
+func TestExpiring_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s, clock := newExpiringForTest(0)
+	deadlines := map[int]time.Time{}
+	live := func() (elems []interface{}) {
+		for i := 0; i < 100; i++ {
+			if d, ok := deadlines[i]; ok && (d.IsZero() || d.After(clock.t)) {
+				elems = append(elems, i)
+			}
+		}
+		return
+	}
+	for i := 0; i < 5000; i++ {
+		x := r.Intn(100)
+		switch r.Intn(4) {
+		case 0:
+			s.Remove(x)
+			delete(deadlines, x)
+		case 1:
+			clock.advance(time.Duration(r.Intn(10)) * time.Second)
+		default:
+			ttl := time.Duration(r.Intn(30)) * time.Second
+			s.AddWithTTL(x, ttl)
+			deadlines[x] = time.Time{}
+			if ttl > 0 {
+				deadlines[x] = clock.t.Add(ttl)
+			}
+		}
+		if want := live(); !reflect.DeepEqual(s.ToSlice(), want) {
+			t.Fatalf("Expected %v. Got %v", want, s.ToSlice())
+		}
+		if s.elems.Size() < s.expiry.Size() {
+			t.Fatalf("Expiry tree holds %v entries for %v elements.", s.expiry.Size(), s.elems.Size())
+		}
+	}
+}
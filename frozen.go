@@ -0,0 +1,216 @@
+package rbtree
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// FrozenSet is an immutable sorted set built by RBTree.Freeze. Its elements
+// are stored in a single slice in Eytzinger (breadth-first) order, so that a
+// search reads from the front of the slice first and its first few levels
+// share cache lines. Searches choose the next index arithmetically rather
+// than by branching on the comparison.
+//
+// A FrozenSet is safe for concurrent use, as long as its comparator is.
+type FrozenSet struct {
+	cmp Comparator
+
+	// elems holds the elements in Eytzinger order, starting at index 1. The
+	// children of index k are 2k and 2k+1. ranks holds each element's index in
+	// sorted order.
+	elems []interface{}
+	ranks []int32
+}
+
+// Freeze returns a FrozenSet holding the tree's elements. The tree itself is
+// left unchanged.
+func (t *RBTree) Freeze() *FrozenSet {
+	sorted := make([]interface{}, 0, t.size)
+	forEachNode(t.root, func(n *node) {
+		sorted = append(sorted, n.elem)
+	})
+	return newFrozenSet(t.cmp, sorted)
+}
+
+// newFrozenSet returns a FrozenSet holding sorted, which must be in order and
+// free of duplicates under cmp.
+func newFrozenSet(cmp Comparator, sorted []interface{}) *FrozenSet {
+	f := &FrozenSet{
+		cmp:   cmp,
+		elems: make([]interface{}, len(sorted)+1),
+		ranks: make([]int32, len(sorted)+1),
+	}
+	f.fill(sorted, 0, 1)
+	return f
+}
+
+// fill places sorted[i:] in the subtree rooted at index k by an in-order walk,
+// returning the index in sorted of the next element to place.
+func (f *FrozenSet) fill(sorted []interface{}, i int, k int) int {
+	if k < len(f.elems) {
+		i = f.fill(sorted, i, 2*k)
+		f.elems[k] = sorted[i]
+		f.ranks[k] = int32(i)
+		i = f.fill(sorted, i+1, 2*k+1)
+	}
+	return i
+}
+
+// Thaw returns a new RBTree, configured by opts, holding the set's elements.
+// It takes O(n) time, as the elements are already sorted.
+func (f *FrozenSet) Thaw(opts ...Option) *RBTree {
+	t := New(f.cmp, opts...)
+	t.buildFrom(f.ToSlice())
+	return t
+}
+
+// lowerBound returns the index of the least element greater than or equal to
+// elem, or 0 if none exists.
+func (f *FrozenSet) lowerBound(elem interface{}) int {
+	k := 1
+	for k < len(f.elems) {
+		// Go right if elems[k] < elem, using the comparison's sign bit.
+		k = 2*k + int(uint(f.cmp(f.elems[k], elem))>>(bits.UintSize-1))
+	}
+	// Undo the right turns taken after the last left turn, and that turn.
+	return k >> (bits.TrailingZeros(^uint(k)) + 1)
+}
+
+// upperBound returns the index of the least element greater than elem, or 0
+// if none exists.
+func (f *FrozenSet) upperBound(elem interface{}) int {
+	k := 1
+	for k < len(f.elems) {
+		// Go right unless elem < elems[k].
+		k = 2*k + 1 - int(uint(f.cmp(elem, f.elems[k]))>>(bits.UintSize-1))
+	}
+	return k >> (bits.TrailingZeros(^uint(k)) + 1)
+}
+
+// Contains uses the set's comparator to check if the given element exists.
+func (f *FrozenSet) Contains(elem interface{}) bool {
+	k := f.lowerBound(elem)
+	return k != 0 && f.cmp(f.elems[k], elem) == 0
+}
+
+// Ceiling returns the least element greater than or equal to elem, or
+// (nil, false) if none exists.
+func (f *FrozenSet) Ceiling(elem interface{}) (interface{}, bool) {
+	return f.at(f.lowerBound(elem))
+}
+
+// Floor returns the greatest element less than or equal to elem, or
+// (nil, false) if none exists.
+func (f *FrozenSet) Floor(elem interface{}) (interface{}, bool) {
+	k := f.upperBound(elem)
+	if k == 0 {
+		return f.Last()
+	}
+	return f.at(f.prev(k))
+}
+
+// Rank returns the number of elements less than elem.
+func (f *FrozenSet) Rank(elem interface{}) int {
+	if k := f.lowerBound(elem); k != 0 {
+		return int(f.ranks[k])
+	}
+	return f.Size()
+}
+
+// First returns the set's smallest element or (nil, false) if f.Size() == 0.
+func (f *FrozenSet) First() (interface{}, bool) {
+	return f.at(f.first())
+}
+
+// Last returns the set's largest element or (nil, false) if f.Size() == 0.
+func (f *FrozenSet) Last() (interface{}, bool) {
+	k := 0
+	for next := 1; next < len(f.elems); next = 2*next + 1 {
+		k = next
+	}
+	return f.at(k)
+}
+
+// Size returns the number of elements in the set.
+func (f *FrozenSet) Size() int {
+	return len(f.elems) - 1
+}
+
+// IsEmpty returns whether the set is empty.
+func (f *FrozenSet) IsEmpty() bool {
+	return f.Size() == 0
+}
+
+// ForEach iterates over the set's elements in sorted order, calling f on
+// each.
+func (f *FrozenSet) ForEach(fn func(interface{})) {
+	for k := f.first(); k != 0; k = f.next(k) {
+		fn(f.elems[k])
+	}
+}
+
+// ToSlice returns the set's elements in a sorted slice.
+func (f *FrozenSet) ToSlice() (s []interface{}) {
+	f.ForEach(func(a interface{}) {
+		s = append(s, a)
+	})
+	return
+}
+
+// String returns a string representation of the set, including its
+// size and first and last elements, if they exist.
+func (f *FrozenSet) String() string {
+	s := "FrozenSet<"
+	s += "Size: " + strconv.Itoa(f.Size())
+	if first, exists := f.First(); exists {
+		s += ", First: " + fmt.Sprintf("%v", first)
+	}
+	if last, exists := f.Last(); exists {
+		s += ", Last: " + fmt.Sprintf("%v", last)
+	}
+	s += ">"
+	return s
+}
+
+func (f *FrozenSet) at(k int) (interface{}, bool) {
+	if k == 0 {
+		return nil, false
+	}
+	return f.elems[k], true
+}
+
+// Returns the index of the smallest element, or 0 if the set is empty.
+func (f *FrozenSet) first() int {
+	k := 0
+	for next := 1; next < len(f.elems); next *= 2 {
+		k = next
+	}
+	return k
+}
+
+// Returns the index following k in sorted order, or 0 if k is the last.
+func (f *FrozenSet) next(k int) int {
+	if 2*k+1 < len(f.elems) {
+		k = 2*k + 1
+		for 2*k < len(f.elems) {
+			k *= 2
+		}
+		return k
+	}
+	// Climb past the right turns, then the left turn.
+	return k >> (bits.TrailingZeros(^uint(k)) + 1)
+}
+
+// Returns the index preceding k in sorted order, or 0 if k is the first.
+func (f *FrozenSet) prev(k int) int {
+	if 2*k < len(f.elems) {
+		k *= 2
+		for 2*k+1 < len(f.elems) {
+			k = 2*k + 1
+		}
+		return k
+	}
+	// Climb past the left turns, then the right turn.
+	return k >> (bits.TrailingZeros(uint(k)) + 1)
+}
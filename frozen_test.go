@@ -0,0 +1,107 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFreeze_AllSizes(t *testing.T) {
+	for size := 0; size < 70; size++ {
+		s := New(IntComparator)
+		want := ints(0, 2*size, 2)
+		for _, v := range want {
+			s.Add(v)
+		}
+		f := s.Freeze()
+		if f.Size() != size {
+			t.Fatalf("Expected size %v. Got %v", size, f.Size())
+		}
+		if !reflect.DeepEqual(f.ToSlice(), s.ToSlice()) {
+			t.Fatalf("Expected %v. Got %v", s.ToSlice(), f.ToSlice())
+		}
+		for v := -1; v <= 2*size; v++ {
+			// The index of the first element >= v.
+			i := sort.Search(len(want), func(i int) bool { return want[i].(int) >= v })
+			if got := f.Contains(v); got != (v%2 == 0 && v >= 0 && v < 2*size) {
+				t.Fatalf("Size %v: Contains(%v) returned %v.", size, v, got)
+			}
+			if got := f.Rank(v); got != i {
+				t.Fatalf("Size %v: expected Rank(%v) = %v. Got %v", size, v, i, got)
+			}
+			ceil, ok := f.Ceiling(v)
+			if ok != (i < size) || ok && ceil != want[i] {
+				t.Fatalf("Size %v: wrong Ceiling(%v). Got %v, %v", size, v, ceil, ok)
+			}
+			j := sort.Search(len(want), func(i int) bool { return want[i].(int) > v }) - 1
+			floor, ok := f.Floor(v)
+			if ok != (j >= 0) || ok && floor != want[j] {
+				t.Fatalf("Size %v: wrong Floor(%v). Got %v, %v", size, v, floor, ok)
+			}
+		}
+	}
+}
+
+func TestFreeze_FirstLast(t *testing.T) {
+	f := New(IntComparator).Freeze()
+	if _, ok := f.First(); ok {
+		t.Fatal("Expected no first element in empty set.")
+	}
+	if _, ok := f.Last(); ok {
+		t.Fatal("Expected no last element in empty set.")
+	}
+	f = newRangeTree(3, 40).Freeze()
+	if first, _ := f.First(); first != 3 {
+		t.Fatalf("Expected 3. Got %v", first)
+	}
+	if last, _ := f.Last(); last != 39 {
+		t.Fatalf("Expected 39. Got %v", last)
+	}
+	if f.String() != "FrozenSet<Size: 37, First: 3, Last: 39>" {
+		t.Fatalf("Unexpected string %v", f.String())
+	}
+}
+
+func TestFreeze_LeavesTreeUnchanged(t *testing.T) {
+	s := newRangeTree(0, 100)
+	f := s.Freeze()
+	s.Add(100)
+	s.Remove(0)
+	checkInvariants(t, s)
+	if f.Contains(100) || !f.Contains(0) {
+		t.Fatal("FrozenSet changed along with its tree.")
+	}
+}
+
+func TestThaw(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for size := 0; size < 200; size += 7 {
+		s := New(IntComparator)
+		for i := 0; i < size; i++ {
+			s.Add(r.Intn(1000))
+		}
+		thawed := s.Freeze().Thaw(WithNodePool())
+		checkInvariants(t, thawed)
+		if !reflect.DeepEqual(thawed.ToSlice(), s.ToSlice()) {
+			t.Fatalf("Expected %v. Got %v", s.ToSlice(), thawed.ToSlice())
+		}
+		thawed.Add(-1)
+		thawed.Remove(-1)
+		checkInvariants(t, thawed)
+	}
+}
+
+func BenchmarkContains_Random_Ints_Frozen(b *testing.B) {
+	s := New(IntComparator)
+	for i := 0; i < startingSize; i++ {
+		s.Add(rand.Intn(startingSize * 2))
+	}
+	f := s.Freeze()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < opsToBench; j++ {
+			f.Contains(rand.Intn(startingSize * 2))
+		}
+	}
+}
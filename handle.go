@@ -0,0 +1,89 @@
+package rbtree
+
+// Handle refers to an element's position in a tree, allowing the element to
+// be reached or removed without searching for it. A handle stays valid until
+// its element is removed from the tree by any means. Replacing the element
+// with an equal one through Add, Update or Compute keeps the handle valid, and
+// Value then returns the new element.
+//
+// The zero Handle is invalid.
+type Handle struct {
+	tree *RBTree
+	n    *node
+}
+
+// AddHandle adds elem as Add does and returns a handle to it. If an equal
+// element already exists, it is replaced and the returned handle refers to
+// the same position as any earlier handle to it. If the tree is full and elem
+// is rejected, the zero Handle is returned.
+func (t *RBTree) AddHandle(elem interface{}) Handle {
+	if t.typed {
+		t.checkElem(elem)
+	}
+	t.hasHandles = true
+	n, parent, cmp := t.search(elem)
+	if n != nilNode {
+		t.replaceElem(n, elem)
+	} else {
+		victim, ok := t.admit(parent, cmp)
+		if !ok {
+			return Handle{}
+		}
+		n = t.insertEvicting(elem, parent, cmp, victim)
+	}
+	n.pinned = true
+	return Handle{tree: t, n: n}
+}
+
+// RemoveHandle removes h's element from the tree without calling the
+// comparator, returning it and true. It returns nil and false if h is
+// invalid or belongs to another tree.
+func (t *RBTree) RemoveHandle(h Handle) (removed interface{}, ok bool) {
+	if h.tree != t || !h.Valid() {
+		return nil, false
+	}
+	removed = h.n.elem
+	t.removeNode(h.n)
+	return removed, true
+}
+
+// Valid returns whether h's element is still in its tree.
+func (h Handle) Valid() bool {
+	return h.n != nil && h.n.linked()
+}
+
+// Value returns h's element. It returns the last element h referred to if h
+// is no longer valid, and nil for the zero Handle.
+func (h Handle) Value() interface{} {
+	if h.n == nil {
+		return nil
+	}
+	return h.n.elem
+}
+
+// Next returns a handle to the element following h's, or false if h's is the
+// last or h is invalid.
+func (h Handle) Next() (Handle, bool) {
+	if !h.Valid() {
+		return Handle{}, false
+	}
+	return h.tree.handleOf(nextNode(h.n))
+}
+
+// Prev returns a handle to the element preceding h's, or false if h's is the
+// first or h is invalid.
+func (h Handle) Prev() (Handle, bool) {
+	if !h.Valid() {
+		return Handle{}, false
+	}
+	return h.tree.handleOf(prevNode(h.n))
+}
+
+func (t *RBTree) handleOf(n *node) (Handle, bool) {
+	if n == nilNode {
+		return Handle{}, false
+	}
+	t.hasHandles = true
+	n.pinned = true
+	return Handle{tree: t, n: n}, true
+}
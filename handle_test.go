@@ -0,0 +1,153 @@
+package rbtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestHandle_SurvivesOtherRemovals(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := New(IntComparator)
+	handles := map[int]Handle{}
+	for i := 0; i < 500; i++ {
+		v := r.Intn(1000)
+		handles[v] = s.AddHandle(v)
+	}
+	for v, h := range handles {
+		if r.Intn(2) == 0 {
+			continue
+		}
+		if removed, ok := s.RemoveHandle(h); !ok || removed != v {
+			t.Fatalf("RemoveHandle: expected (%v, true). Got (%v, %v)", v, removed, ok)
+		}
+		if h.Valid() {
+			t.Fatalf("Handle to %v valid after removal.", v)
+		}
+		delete(handles, v)
+		checkInvariants(t, s)
+	}
+	for v, h := range handles {
+		if !h.Valid() || h.Value() != v {
+			t.Fatalf("Handle to %v lost: valid %v, value %v", v, h.Valid(), h.Value())
+		}
+	}
+	if s.Size() != len(handles) {
+		t.Fatalf("Expected size %v. Got %v", len(handles), s.Size())
+	}
+}
+
+func TestHandle_SurvivesRemoveByValue(t *testing.T) {
+	// Removing a node with two children used to move its successor's element
+	// into it, which would leave a handle to the successor pointing at a
+	// removed node.
+	s := newRangeTree(0, 20)
+	handles := make([]Handle, 20)
+	for i := range handles {
+		handles[i] = s.AddHandle(i)
+	}
+	for i := 0; i < 20; i += 2 {
+		s.Remove(i)
+	}
+	for i, h := range handles {
+		if h.Valid() != (i%2 == 1) {
+			t.Fatalf("Handle to %v: Valid() = %v", i, h.Valid())
+		}
+		if h.Valid() && h.Value() != i {
+			t.Fatalf("Handle to %v now holds %v", i, h.Value())
+		}
+	}
+}
+
+func TestRemoveHandle_SkipsComparator(t *testing.T) {
+	s := New(IntComparator)
+	var handles []Handle
+	for i := 0; i < 10; i++ {
+		handles = append(handles, s.AddHandle(i))
+	}
+	s.cmp = faultyComparator(1)
+	for _, h := range handles {
+		if _, ok := s.RemoveHandle(h); !ok {
+			t.Fatalf("Failed to remove %v", h.Value())
+		}
+	}
+	if !s.IsEmpty() {
+		t.Fatal("Set not empty.")
+	}
+}
+
+func TestHandle_NextPrev(t *testing.T) {
+	s := newRangeTree(0, 10)
+	h := s.AddHandle(5)
+	next, ok := h.Next()
+	if !ok || next.Value() != 6 {
+		t.Fatalf("Expected 6. Got %v", next.Value())
+	}
+	prev, ok := h.Prev()
+	if !ok || prev.Value() != 4 {
+		t.Fatalf("Expected 4. Got %v", prev.Value())
+	}
+	last := s.AddHandle(9)
+	if _, ok := last.Next(); ok {
+		t.Fatal("Last element had a next element.")
+	}
+	first := s.AddHandle(0)
+	if _, ok := first.Prev(); ok {
+		t.Fatal("First element had a previous element.")
+	}
+
+	s.RemoveHandle(h)
+	if _, ok := h.Next(); ok {
+		t.Fatal("Removed handle had a next element.")
+	}
+	if next, _ := prev.Next(); next.Value() != 6 {
+		t.Fatalf("Expected 6. Got %v", next.Value())
+	}
+}
+
+func TestHandle_ReplacedElement(t *testing.T) {
+	s := New(keyedComparator)
+	h := s.AddHandle(keyed{1, "a"})
+	s.Add(keyed{1, "b"})
+	if !h.Valid() || h.Value() != (keyed{1, "b"}) {
+		t.Fatalf("Expected {1 b}. Got %v", h.Value())
+	}
+	if h2 := s.AddHandle(keyed{1, "c"}); h2 != h {
+		t.Fatal("Handles to equal elements differ.")
+	}
+}
+
+func TestHandle_InvalidatedByBulkRemoval(t *testing.T) {
+	s := newRangeTree(0, 10)
+	h3, h7 := s.AddHandle(3), s.AddHandle(7)
+	s.RemoveRange(2, 5)
+	if h3.Valid() || !h7.Valid() {
+		t.Fatalf("After RemoveRange: h3 valid %v, h7 valid %v", h3.Valid(), h7.Valid())
+	}
+	s.RemoveIf(func(e interface{}) bool { return e.(int) > 6 })
+	if h7.Valid() {
+		t.Fatal("Handle valid after RemoveIf.")
+	}
+	h1 := s.AddHandle(1)
+	s.Clear()
+	if h1.Valid() {
+		t.Fatal("Handle valid after Clear.")
+	}
+}
+
+func TestRemoveHandle_Invalid(t *testing.T) {
+	s, other := newRangeTree(0, 3), newRangeTree(0, 3)
+	if _, ok := s.RemoveHandle(Handle{}); ok {
+		t.Fatal("Removed zero handle.")
+	}
+	if _, ok := s.RemoveHandle(other.AddHandle(1)); ok {
+		t.Fatal("Removed handle from another tree.")
+	}
+	h := s.AddHandle(1)
+	s.RemoveHandle(h)
+	if _, ok := s.RemoveHandle(h); ok {
+		t.Fatal("Removed handle twice.")
+	}
+	if s.Size() != 2 || other.Size() != 3 {
+		t.Fatalf("Unexpected sizes %v and %v", s.Size(), other.Size())
+	}
+}
@@ -0,0 +1,131 @@
+package rbtree
+
+// Hasher returns a hash of an element. Equal elements, as determined by the
+// tree's comparator, which are meant to be interchangeable must hash the
+// same, and unequal elements should hash differently with high probability.
+type Hasher func(elem interface{}) uint64
+
+// WithHasher makes the tree maintain a hash of each subtree's elements, so
+// that RootHash and RangeHash take O(log n) time. Each node holds the sum of
+// its subtree's element hashes, after they are mixed to spread their bits,
+// which is kept up to date by every change to the tree. The sum doesn't
+// depend on the tree's shape, so trees with equal elements have equal hashes
+// however they were built.
+//
+// The hashes are meant for detecting differences between replicas, and are
+// not secure against deliberately crafted collisions.
+func WithHasher(h Hasher) Option {
+	return func(t *RBTree) {
+		t.hasher = h
+	}
+}
+
+// RootHash returns a hash of all the tree's elements. It panics if the tree
+// wasn't created with WithHasher.
+func (t *RBTree) RootHash() uint64 {
+	t.mustHash()
+	return t.root.sum
+}
+
+// RangeHash returns a hash of the elements e with lo <= e < hi, which equals
+// RootHash for a tree holding exactly those elements. It panics if the tree
+// wasn't created with WithHasher.
+func (t *RBTree) RangeHash(lo, hi interface{}) uint64 {
+	t.mustHash()
+	if t.typed {
+		t.checkElem(lo)
+		t.checkElem(hi)
+	}
+	if t.cmp(lo, hi) >= 0 {
+		return 0
+	}
+	return t.sumBelow(hi, false) - t.sumBelow(lo, false)
+}
+
+// Hash returns a hash of the elements within the view's range, as
+// RBTree.RangeHash does. It panics if the tree wasn't created with
+// WithHasher.
+func (v *View) Hash() uint64 {
+	t := v.tree
+	t.mustHash()
+	if v.lowNode() == nilNode {
+		return 0
+	}
+	sum := t.root.sum
+	if v.hasHi {
+		sum = t.sumBelow(v.hi, v.hiInclusive)
+	}
+	if v.hasLo {
+		sum -= t.sumBelow(v.lo, !v.loInclusive)
+	}
+	return sum
+}
+
+func (t *RBTree) mustHash() {
+	if t.hasher == nil {
+		panic("rbtree: tree has no hasher; see WithHasher")
+	}
+}
+
+// sumBelow returns the sum of the hashes of the elements less than x, or
+// equal to it if orEqual is set.
+func (t *RBTree) sumBelow(x interface{}, orEqual bool) uint64 {
+	var sum uint64
+	for n := t.root; n != nilNode; {
+		if cmp := t.cmp(x, n.elem); cmp > 0 || cmp == 0 && orEqual {
+			sum += n.sum - n.rightChild.sum
+			n = n.rightChild
+		} else {
+			n = n.leftChild
+		}
+	}
+	return sum
+}
+
+// hash returns elem's mixed hash, which is what node sums add up.
+func (t *RBTree) hash(elem interface{}) uint64 {
+	return mix64(t.hasher(elem))
+}
+
+// mix64 is a step of SplitMix64: the golden gamma is added before the
+// finalizer, which would otherwise map 0 to 0, leaving elements which hash to
+// 0 out of every sum. Summing raw hashes would let common patterns, like
+// hashes which are small integers, cancel out.
+func mix64(z uint64) uint64 {
+	z += 0x9e3779b97f4a7c15
+	z ^= z >> 30
+	z *= 0xbf58476d1ce4e5b9
+	z ^= z >> 27
+	z *= 0x94d049bb133111eb
+	z ^= z >> 31
+	return z
+}
+
+// ownSum returns the hash of n's own element, from the sums of n and its
+// children.
+func ownSum(n *node) uint64 {
+	return n.sum - n.leftChild.sum - n.rightChild.sum
+}
+
+// addSum adds d to the sums of n and its ancestors.
+func addSum(n *node, d uint64) {
+	for ; n != nilNode; n = n.parent {
+		n.sum += d
+	}
+}
+
+// addChildSums completes the sums of n's subtree, each of whose nodes holds
+// only its own element's hash, and returns n's sum.
+func addChildSums(n *node) uint64 {
+	if n == nilNode {
+		return 0
+	}
+	n.sum += addChildSums(n.leftChild) + addChildSums(n.rightChild)
+	return n.sum
+}
+
+// rotateSums updates the sums of n and its child c before a rotation which
+// puts c in n's place, with moved, c's inner child, becoming n's child.
+func rotateSums(n *node, c *node, moved *node) {
+	n.sum, c.sum = n.sum-c.sum+moved.sum, n.sum
+}
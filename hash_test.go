@@ -0,0 +1,130 @@
+package rbtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+var intHasher Hasher = func(elem interface{}) uint64 {
+	return uint64(elem.(int))
+}
+
+// sumOf returns the expected hash of elems.
+func sumOf(s *RBTree, elems []interface{}) (sum uint64) {
+	for _, elem := range elems {
+		sum += s.hash(elem)
+	}
+	return
+}
+
+func TestHash_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := New(IntComparator, WithHasher(intHasher), WithNodePool())
+	for i := 0; i < 3000; i++ {
+		x := r.Intn(500)
+		switch r.Intn(10) {
+		case 0:
+			s.RemoveRange(x, x+r.Intn(50))
+		case 1:
+			s.RemoveIf(func(elem interface{}) bool { return elem.(int)%7 == x%7 })
+		case 2:
+			s.PopMin()
+		case 3, 4, 5:
+			s.Remove(x)
+		default:
+			s.Add(x)
+		}
+		if i%100 == 0 {
+			checkInvariants(t, s)
+		}
+	}
+	checkInvariants(t, s)
+	if nilNode.sum != 0 {
+		t.Fatal("nilNode's sum was changed.")
+	}
+
+	// Trees with the same elements have the same hash, whatever their shape.
+	elems := s.ToSlice()
+	other := New(IntComparator, WithHasher(intHasher))
+	for _, i := range r.Perm(len(elems)) {
+		other.Add(elems[i])
+	}
+	if other.RootHash() != s.RootHash() || s.RootHash() != sumOf(s, elems) {
+		t.Fatalf("Expected hash %v. Got %v and %v", sumOf(s, elems), s.RootHash(), other.RootHash())
+	}
+	for i := 0; i < 200; i++ {
+		lo, hi := r.Intn(600)-50, r.Intn(600)-50
+		var want []interface{}
+		s.ForEach(func(elem interface{}) {
+			if elem.(int) >= lo && elem.(int) < hi {
+				want = append(want, elem)
+			}
+		})
+		if got := s.RangeHash(lo, hi); got != sumOf(s, want) {
+			t.Fatalf("RangeHash(%v, %v): expected %v. Got %v", lo, hi, sumOf(s, want), got)
+		}
+	}
+}
+
+func TestHash_Replace(t *testing.T) {
+	hasher := func(elem interface{}) uint64 {
+		return uint64(elem.(keyed).key) + uint64(len(elem.(keyed).val))<<32
+	}
+	s := New(keyedComparator, WithHasher(hasher))
+	for i := 0; i < 10; i++ {
+		s.Add(keyed{i, "a"})
+	}
+	before := s.RootHash()
+	s.Add(keyed{5, "bb"})
+	checkInvariants(t, s)
+	if s.RootHash() == before {
+		t.Fatal("Expected replacing an element to change the hash.")
+	}
+	s.Update(keyed{5, ""}, func(interface{}) interface{} { return keyed{5, "a"} })
+	checkInvariants(t, s)
+	if s.RootHash() != before {
+		t.Fatal("Expected the hash to be restored with the original element.")
+	}
+}
+
+func TestHash_Thaw(t *testing.T) {
+	s := New(IntComparator, WithHasher(intHasher))
+	for i := 0; i < 100; i++ {
+		s.Add(i)
+	}
+	thawed := s.Freeze().Thaw(WithHasher(intHasher))
+	checkInvariants(t, thawed)
+	if thawed.RootHash() != s.RootHash() {
+		t.Fatalf("Expected %v. Got %v", s.RootHash(), thawed.RootHash())
+	}
+	s.Clear()
+	if s.RootHash() != 0 || s.RangeHash(0, 100) != 0 {
+		t.Fatal("Expected an empty tree to hash to 0.")
+	}
+}
+
+func TestHash_ZeroHash(t *testing.T) {
+	hasher := func(elem interface{}) uint64 {
+		return uint64(len(elem.(string)))
+	}
+	a := New(StringComparator, WithHasher(hasher))
+	b := New(StringComparator, WithHasher(hasher))
+	a.Add("x")
+	b.Add("x")
+	b.Add("")
+	if a.RootHash() == b.RootHash() {
+		t.Fatal("Expected an element hashing to 0 to change the root hash.")
+	}
+	if b.RangeHash("", "a") == 0 {
+		t.Fatal("Expected an element hashing to 0 to change the range hash.")
+	}
+}
+
+func TestHash_NoHasher(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected RootHash to panic without a hasher.")
+		}
+	}()
+	New(IntComparator).RootHash()
+}
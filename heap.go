@@ -0,0 +1,90 @@
+package rbtree
+
+// Heap adapts an RBTree to heap.Interface, for code written against
+// container/heap. The tree keeps its elements sorted, so heap.Push and
+// heap.Pop take O(log n) time, and the heap's minimum is always at index 0.
+//
+// Index i refers to the element of rank i in the heap's order. Less compares
+// indexes rather than elements, and Swap only records which index heap.Pop or
+// heap.Remove is about to remove, so the tree is never reordered. heap.Remove
+// with an index other than 0 or Len()-1 takes O(i) time to find the element.
+//
+// Since the tree is a set, pushing an element equal to an existing one
+// replaces it rather than growing the heap. heap.Fix has no effect; to change
+// an element's priority, remove it and push it again.
+type Heap struct {
+	tree *RBTree
+	max  bool
+
+	// popIndex is the index last passed to Swap, which is the one that
+	// heap.Pop and heap.Remove go on to remove. It is -1 if Swap hasn't been
+	// called since the last Pop, in which case the last index is removed.
+	popIndex int
+}
+
+// NewHeap returns a min-heap over t's elements.
+func NewHeap(t *RBTree) *Heap {
+	return &Heap{tree: t, popIndex: -1}
+}
+
+// NewMaxHeap returns a max-heap over t's elements.
+func NewMaxHeap(t *RBTree) *Heap {
+	return &Heap{tree: t, max: true, popIndex: -1}
+}
+
+// Len returns the number of elements in the tree.
+func (h *Heap) Len() int {
+	return h.tree.Size()
+}
+
+// Less reports whether index i comes before index j.
+func (h *Heap) Less(i, j int) bool {
+	return i < j
+}
+
+// Swap records that index i is about to be removed. The lower of i and j is
+// always the one that container/heap moves to the end to pop.
+func (h *Heap) Swap(i, j int) {
+	if j < i {
+		i = j
+	}
+	h.popIndex = i
+}
+
+// Push adds x to the tree.
+func (h *Heap) Push(x interface{}) {
+	h.tree.Add(x)
+}
+
+// Pop removes and returns the element container/heap asked to remove.
+func (h *Heap) Pop() interface{} {
+	i := h.popIndex
+	h.popIndex = -1
+	if i < 0 {
+		i = h.Len() - 1
+	}
+	n := h.nodeAt(i)
+	elem := n.elem
+	h.tree.removeNode(n)
+	return elem
+}
+
+// Returns the node at index i in the heap's order.
+func (h *Heap) nodeAt(i int) *node {
+	t := h.tree
+	if h.max {
+		i = t.size - 1 - i
+	}
+	if i < t.size/2 {
+		n := t.min
+		for ; i > 0; i-- {
+			n = nextNode(n)
+		}
+		return n
+	}
+	n := t.max
+	for i = t.size - 1 - i; i > 0; i-- {
+		n = prevNode(n)
+	}
+	return n
+}
@@ -0,0 +1,161 @@
+package rbtree
+
+// History records the changes made through it to an RBTree, so that they can
+// be undone and redone. Changes are grouped by Checkpoint, and Undo and Redo
+// act on a whole group at a time.
+//
+// Every change to the tree must be made through the History for undo to
+// restore its earlier contents. Undo restores the tree's elements, including
+// the exact elements that were replaced, but not necessarily its shape.
+type History struct {
+	tree  *RBTree
+	limit int
+
+	// current collects the changes made since the last checkpoint. undone
+	// holds groups in the order they were undone, so the last is redone
+	// first.
+	current []histOp
+	done    []histGroup
+	undone  []histGroup
+}
+
+type histGroup struct {
+	name string
+	ops  []histOp
+}
+
+// histOp records a change: elem was added, replacing old if replaced was set,
+// or elem was removed if remove is set.
+type histOp struct {
+	elem     interface{}
+	old      interface{}
+	replaced bool
+	remove   bool
+}
+
+// NewHistory returns a History of changes to t, keeping at most limit groups
+// of changes for Undo. If limit is 0 or less, the history is unbounded.
+func NewHistory(t *RBTree, limit int) *History {
+	return &History{tree: t, limit: limit}
+}
+
+// Tree returns the tree that h records changes to.
+func (h *History) Tree() *RBTree {
+	return h.tree
+}
+
+// Add adds elem to the tree, as RBTree.Add does, and records the change.
+func (h *History) Add(elem interface{}) (old interface{}, replaced bool) {
+	r := h.Offer(elem)
+	return r.Old, r.Replaced
+}
+
+// Offer adds elem to the tree, as RBTree.Offer does, and records the change,
+// along with the eviction of any element to make room for it. Nothing is
+// recorded if elem is rejected.
+func (h *History) Offer(elem interface{}) AddResult {
+	r := h.tree.Offer(elem)
+	if r.Evicted {
+		// The eviction is recorded first, so that Undo removes elem before
+		// adding the victim back, and the tree never goes over capacity.
+		h.record(histOp{elem: r.Victim, remove: true})
+	}
+	if r.Added {
+		h.record(histOp{elem: elem, old: r.Old, replaced: r.Replaced})
+	}
+	return r
+}
+
+// Remove removes elem from the tree, as RBTree.Remove does, and records the
+// change if an element was removed.
+func (h *History) Remove(elem interface{}) (removed interface{}, ok bool) {
+	removed, ok = h.tree.Remove(elem)
+	if ok {
+		h.record(histOp{elem: removed, remove: true})
+	}
+	return removed, ok
+}
+
+// A new change can't be redone past, so the redo history is dropped.
+func (h *History) record(op histOp) {
+	h.current = append(h.current, op)
+	h.undone = nil
+}
+
+// Checkpoint ends the group of changes made since the last checkpoint,
+// labelling it name. It does nothing if no changes have been made since.
+func (h *History) Checkpoint(name string) {
+	if len(h.current) == 0 {
+		return
+	}
+	h.done = append(h.done, histGroup{name: name, ops: h.current})
+	h.current = nil
+	if h.limit > 0 && len(h.done) > h.limit {
+		n := len(h.done) - h.limit
+		copy(h.done, h.done[n:])
+		for i := len(h.done) - n; i < len(h.done); i++ {
+			h.done[i] = histGroup{}
+		}
+		h.done = h.done[:len(h.done)-n]
+	}
+}
+
+// Undo reverts the last group of changes, returning its name, or returns
+// ("", false) if there is nothing to undo. Changes made since the last
+// checkpoint are first grouped as if by Checkpoint("").
+func (h *History) Undo() (name string, ok bool) {
+	h.Checkpoint("")
+	if len(h.done) == 0 {
+		return "", false
+	}
+	g := h.done[len(h.done)-1]
+	h.done = h.done[:len(h.done)-1]
+	for i := len(g.ops) - 1; i >= 0; i-- {
+		op := g.ops[i]
+		switch {
+		case op.remove:
+			h.tree.Add(op.elem)
+		case op.replaced:
+			h.tree.Add(op.old)
+		default:
+			h.tree.Remove(op.elem)
+		}
+	}
+	h.undone = append(h.undone, g)
+	return g.name, true
+}
+
+// Redo reapplies the last group of changes reverted by Undo, returning its
+// name, or returns ("", false) if there is nothing to redo. Any change made
+// after an Undo clears the changes available to Redo.
+func (h *History) Redo() (name string, ok bool) {
+	if len(h.undone) == 0 {
+		return "", false
+	}
+	g := h.undone[len(h.undone)-1]
+	h.undone = h.undone[:len(h.undone)-1]
+	for _, op := range g.ops {
+		if op.remove {
+			h.tree.Remove(op.elem)
+		} else {
+			h.tree.Add(op.elem)
+		}
+	}
+	h.done = append(h.done, g)
+	return g.name, true
+}
+
+// CanUndo returns whether there are changes to undo.
+func (h *History) CanUndo() bool {
+	return len(h.current) != 0 || len(h.done) != 0
+}
+
+// CanRedo returns whether there are changes to redo.
+func (h *History) CanRedo() bool {
+	return len(h.undone) != 0
+}
+
+// Clear forgets all recorded changes, leaving the tree as it is.
+func (h *History) Clear() {
+	h.current, h.done, h.undone = nil, nil, nil
+}
@@ -0,0 +1,217 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestHistory_RoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, limit := range []int{0, 1, 5} {
+		s := New(keyedComparator)
+		h := NewHistory(s, limit)
+		// past and future hold the contents that Undo and Redo should
+		// restore, and last the contents at the last checkpoint.
+		var past, future [][]interface{}
+		last := s.ToSlice()
+		dirty := false
+		checkpoint := func(name string) {
+			h.Checkpoint(name)
+			if dirty {
+				past = append(past, last)
+				if limit > 0 && len(past) > limit {
+					past = past[1:]
+				}
+				last = s.ToSlice()
+				dirty = false
+			}
+		}
+		for i := 0; i < 5000; i++ {
+			switch r.Intn(10) {
+			case 0:
+				checkpoint("c" + strconv.Itoa(i))
+			case 1:
+				checkpoint("")
+				_, ok := h.Undo()
+				if ok != (len(past) > 0) {
+					t.Fatalf("Expected Undo to return %v.", len(past) > 0)
+				}
+				if ok {
+					future = append(future, last)
+					last, past = past[len(past)-1], past[:len(past)-1]
+				}
+			case 2:
+				_, ok := h.Redo()
+				if ok != (len(future) > 0) {
+					t.Fatalf("Expected Redo to return %v.", len(future) > 0)
+				}
+				if !ok {
+					// There may be changes since the last checkpoint.
+					continue
+				}
+				past = append(past, last)
+				last, future = future[len(future)-1], future[:len(future)-1]
+			default:
+				k := keyed{key: r.Intn(40), val: strconv.Itoa(r.Int())}
+				if r.Intn(3) == 0 {
+					_, ok := h.Remove(k)
+					dirty = dirty || ok
+				} else {
+					h.Add(k)
+					dirty = true
+				}
+				if dirty {
+					future = nil
+				}
+				continue
+			}
+			if !reflect.DeepEqual(s.ToSlice(), last) {
+				t.Fatalf("Step %v: expected %v. Got %v", i, last, s.ToSlice())
+			}
+		}
+		checkInvariants(t, s)
+	}
+}
+
+func TestHistory_UndoRedo(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	s := New(keyedComparator)
+	h := NewHistory(s, 0)
+	var states [][]interface{}
+	var names []string
+	for c := 0; c < 50; c++ {
+		states = append(states, s.ToSlice())
+		for i := 0; i < 1+r.Intn(10); i++ {
+			k := keyed{key: r.Intn(20), val: strconv.Itoa(r.Int())}
+			if r.Intn(3) == 0 {
+				if _, ok := h.Remove(k); !ok {
+					h.Add(k)
+				}
+			} else {
+				h.Add(k)
+			}
+		}
+		names = append(names, "c"+strconv.Itoa(c))
+		h.Checkpoint(names[c])
+	}
+	final := s.ToSlice()
+	for c := len(names) - 1; c >= 0; c-- {
+		if name, ok := h.Undo(); !ok || name != names[c] {
+			t.Fatalf("Expected to undo %v. Got %v, %v", names[c], name, ok)
+		}
+		if !reflect.DeepEqual(s.ToSlice(), states[c]) {
+			t.Fatalf("Undo of %v: expected %v. Got %v", names[c], states[c], s.ToSlice())
+		}
+	}
+	if _, ok := h.Undo(); ok {
+		t.Fatal("Expected nothing to undo.")
+	}
+	for c := range names {
+		if name, ok := h.Redo(); !ok || name != names[c] {
+			t.Fatalf("Expected to redo %v. Got %v, %v", names[c], name, ok)
+		}
+		if c+1 < len(states) && !reflect.DeepEqual(s.ToSlice(), states[c+1]) {
+			t.Fatalf("Redo of %v: expected %v. Got %v", names[c], states[c+1], s.ToSlice())
+		}
+	}
+	if !reflect.DeepEqual(s.ToSlice(), final) {
+		t.Fatalf("Expected %v. Got %v", final, s.ToSlice())
+	}
+	if _, ok := h.Redo(); ok {
+		t.Fatal("Expected nothing to redo.")
+	}
+	checkInvariants(t, s)
+}
+
+func TestHistory_RestoresReplacedElement(t *testing.T) {
+	s := New(keyedComparator)
+	h := NewHistory(s, 0)
+	h.Add(keyed{1, "a"})
+	h.Checkpoint("add")
+	if old, replaced := h.Add(keyed{1, "b"}); !replaced || old != (keyed{1, "a"}) {
+		t.Fatalf("Expected to replace {1 a}. Got %v", old)
+	}
+	h.Undo()
+	if got, _ := s.Get(keyed{1, ""}); got != (keyed{1, "a"}) {
+		t.Fatalf("Expected {1 a}. Got %v", got)
+	}
+	h.Redo()
+	if got, _ := s.Get(keyed{1, ""}); got != (keyed{1, "b"}) {
+		t.Fatalf("Expected {1 b}. Got %v", got)
+	}
+}
+
+func TestHistory_ChangeClearsRedo(t *testing.T) {
+	s := New(IntComparator)
+	h := NewHistory(s, 0)
+	h.Add(1)
+	h.Checkpoint("one")
+	h.Undo()
+	if !h.CanRedo() {
+		t.Fatal("Expected to be able to redo.")
+	}
+	h.Add(2)
+	if h.CanRedo() {
+		t.Fatal("Expected change after Undo to clear redo history.")
+	}
+	if name, ok := h.Undo(); !ok || name != "" {
+		t.Fatalf("Expected to undo unnamed group. Got %v, %v", name, ok)
+	}
+	if !s.IsEmpty() {
+		t.Fatalf("Expected empty tree. Got %v", s.ToSlice())
+	}
+}
+
+func TestHistory_Limit(t *testing.T) {
+	s := New(IntComparator)
+	h := NewHistory(s, 3)
+	for i := 0; i < 10; i++ {
+		h.Add(i)
+		h.Checkpoint(strconv.Itoa(i))
+	}
+	for i := 9; i >= 7; i-- {
+		if name, ok := h.Undo(); !ok || name != strconv.Itoa(i) {
+			t.Fatalf("Expected to undo %v. Got %v, %v", i, name, ok)
+		}
+	}
+	if _, ok := h.Undo(); ok {
+		t.Fatal("Expected history to be limited to 3 groups.")
+	}
+	if !reflect.DeepEqual(s.ToSlice(), ints(0, 7, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(0, 7, 1), s.ToSlice())
+	}
+}
+
+func TestHistory_Capacity(t *testing.T) {
+	for _, policy := range []EvictionPolicy{EvictMin, EvictMax, RejectNew} {
+		s := New(IntComparator, WithCapacity(2, policy))
+		h := NewHistory(s, 0)
+		h.Add(1)
+		h.Add(2)
+		h.Checkpoint("fill")
+		h.Add(3)
+		h.Add(0)
+		h.Checkpoint("overflow")
+		after := s.ToSlice()
+		if policy == RejectNew {
+			// Nothing was added, so nothing was recorded.
+			if name, _ := h.Undo(); name != "fill" || !s.IsEmpty() {
+				t.Fatalf("Expected to undo fill. Got %v and %v", name, s.ToSlice())
+			}
+			continue
+		}
+		if name, _ := h.Undo(); name != "overflow" {
+			t.Fatalf("Expected to undo overflow. Got %v", name)
+		}
+		checkInvariants(t, s)
+		if got := s.ToSlice(); !reflect.DeepEqual(got, ints(1, 3, 1)) {
+			t.Fatalf("Policy %v: expected [1 2]. Got %v", policy, got)
+		}
+		h.Redo()
+		if got := s.ToSlice(); !reflect.DeepEqual(got, after) {
+			t.Fatalf("Policy %v: expected %v. Got %v", policy, after, got)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package rbtree
+
+// Link holds the parent, child and color fields that an IntrusiveTree uses to
+// link an item in. Embedding a Link in a struct makes pointers to that struct
+// Items:
+//
+//	type Job struct {
+//		rbtree.Link
+//		Deadline time.Time
+//	}
+//
+// Adding an Item to an IntrusiveTree then allocates nothing, since the tree's
+// node lives inside the item. An item can be in at most one tree at a time.
+// The zero Link is not in any tree.
+type Link struct {
+	n node
+}
+
+func (l *Link) rbLink() *Link {
+	return l
+}
+
+// Linked returns whether the item embedding l is in a tree.
+func (l *Link) Linked() bool {
+	return l.n.linked()
+}
+
+// Item is implemented by pointers to structs that embed a Link.
+type Item interface {
+	rbLink() *Link
+}
+
+// IntrusiveTree is a red-black tree of Items, linked through the Link each
+// embeds rather than through nodes allocated by the tree. It shares RBTree's
+// algorithms, so it has the same ordering and complexity guarantees.
+//
+// The comparator is given Items, as the elements of the tree, and may also be
+// given whatever probe values are passed to Get.
+type IntrusiveTree struct {
+	tree *RBTree
+}
+
+// NewIntrusive returns an empty IntrusiveTree which uses the given comparator.
+func NewIntrusive(cmp Comparator) *IntrusiveTree {
+	t := New(cmp)
+	// Clear must unlink each item so that it can be added again.
+	t.hasHandles = true
+	return &IntrusiveTree{tree: t}
+}
+
+// Add links item into the tree. If an equal item is already in the tree, it
+// is unlinked, item takes its place, and the old item is returned with
+// replaced set to true. Add panics if item is already in a tree.
+func (it *IntrusiveTree) Add(item Item) (old Item, replaced bool) {
+	n := &item.rbLink().n
+	if n.linked() {
+		panic("rbtree: item is already in a tree")
+	}
+	t := it.tree
+	existing, parent, cmp := t.search(item)
+	n.elem = item
+	if existing != nilNode {
+		old = existing.elem.(Item)
+		t.replaceNode(existing, n)
+		return old, true
+	}
+	t.linkAt(n, parent, cmp)
+	return nil, false
+}
+
+// Remove unlinks item from the tree without calling the comparator. It
+// returns false if item is not in this tree.
+func (it *IntrusiveTree) Remove(item Item) bool {
+	n := &item.rbLink().n
+	if !n.linked() || !it.owns(n) {
+		return false
+	}
+	it.tree.removeNode(n)
+	n.elem = nil
+	return true
+}
+
+// Get returns the item equal to probe, or (nil, false) if none exists.
+func (it *IntrusiveTree) Get(probe interface{}) (Item, bool) {
+	if n := it.tree.getNode(probe); n != nil {
+		return n.elem.(Item), true
+	}
+	return nil, false
+}
+
+// Contains returns whether item is linked into this tree. It doesn't call the
+// comparator.
+func (it *IntrusiveTree) Contains(item Item) bool {
+	n := &item.rbLink().n
+	return n.linked() && it.owns(n)
+}
+
+// First returns the smallest item, or (nil, false) if the tree is empty.
+func (it *IntrusiveTree) First() (Item, bool) {
+	return itemOf(it.tree.min)
+}
+
+// Last returns the largest item, or (nil, false) if the tree is empty.
+func (it *IntrusiveTree) Last() (Item, bool) {
+	return itemOf(it.tree.max)
+}
+
+// Next returns the item following item in this tree, or (nil, false) if item
+// is the last or not in this tree.
+func (it *IntrusiveTree) Next(item Item) (Item, bool) {
+	if !it.Contains(item) {
+		return nil, false
+	}
+	return itemOf(nextNode(&item.rbLink().n))
+}
+
+// Prev returns the item preceding item in this tree, or (nil, false) if item
+// is the first or not in this tree.
+func (it *IntrusiveTree) Prev(item Item) (Item, bool) {
+	if !it.Contains(item) {
+		return nil, false
+	}
+	return itemOf(prevNode(&item.rbLink().n))
+}
+
+// Size returns the number of items in the tree.
+func (it *IntrusiveTree) Size() int {
+	return it.tree.Size()
+}
+
+// IsEmpty returns whether the tree is empty.
+func (it *IntrusiveTree) IsEmpty() bool {
+	return it.tree.IsEmpty()
+}
+
+// ForEach iterates over the tree's items in sorted order, calling f on each.
+// Like RBTree.ForEach, it panics with ErrModified if f adds or removes items.
+func (it *IntrusiveTree) ForEach(f func(Item)) {
+	it.tree.ForEach(func(elem interface{}) {
+		f(elem.(Item))
+	})
+}
+
+// Clear unlinks every item, in O(n) time.
+func (it *IntrusiveTree) Clear() {
+	it.tree.Clear()
+}
+
+// Returns whether n, which must be linked, is in this tree, by walking up to
+// its root.
+func (it *IntrusiveTree) owns(n *node) bool {
+	for n.parent != nilNode {
+		n = n.parent
+	}
+	return n == it.tree.root
+}
+
+func itemOf(n *node) (Item, bool) {
+	if n == nilNode {
+		return nil, false
+	}
+	return n.elem.(Item), true
+}
+
+// replaceNode puts n in old's place in the tree, with old's links and color,
+// and marks old as removed.
+func (t *RBTree) replaceNode(old *node, n *node) {
+	n.color = old.color
+	n.leftChild, n.rightChild = old.leftChild, old.rightChild
+	setParent(n.leftChild, n)
+	setParent(n.rightChild, n)
+	t.replaceChild(old, n)
+	if t.min == old {
+		t.min = n
+	}
+	if t.max == old {
+		t.max = n
+	}
+	markRemoved(old)
+	t.modCount++
+	if t.obs != nil {
+		t.notify(Event{Kind: Replaced, Elem: n.elem, Old: old.elem})
+	}
+}
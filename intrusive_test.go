@@ -0,0 +1,174 @@
+package rbtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+type job struct {
+	Link
+	key int
+}
+
+var jobComparator Comparator = func(a, b interface{}) int {
+	return a.(*job).key - b.(*job).key
+}
+
+func TestIntrusive_AddRemove(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	it := NewIntrusive(jobComparator)
+	jobs := make([]*job, 500)
+	for i := range jobs {
+		jobs[i] = &job{key: i}
+	}
+	for _, i := range r.Perm(len(jobs)) {
+		if _, replaced := it.Add(jobs[i]); replaced {
+			t.Fatalf("Unexpected replace of %v", i)
+		}
+	}
+	checkInvariants(t, it.tree)
+	for _, i := range r.Perm(len(jobs))[:250] {
+		if !it.Remove(jobs[i]) {
+			t.Fatalf("Failed to remove %v", i)
+		}
+		if jobs[i].Linked() || it.Contains(jobs[i]) {
+			t.Fatalf("%v still linked after removal.", i)
+		}
+	}
+	checkInvariants(t, it.tree)
+
+	prev := -1
+	it.ForEach(func(item Item) {
+		j := item.(*job)
+		if j.key <= prev || !it.Contains(j) {
+			t.Fatalf("Unexpected item %v after %v", j.key, prev)
+		}
+		prev = j.key
+	})
+	if it.Size() != 250 {
+		t.Fatalf("Expected size 250. Got %v", it.Size())
+	}
+}
+
+func TestIntrusive_Replace(t *testing.T) {
+	it := NewIntrusive(jobComparator)
+	for i := 0; i < 10; i++ {
+		it.Add(&job{key: i})
+	}
+	a := &job{key: 5}
+	old, replaced := it.Add(a)
+	if !replaced || old.(*job).key != 5 || old == Item(a) {
+		t.Fatalf("Expected old item with key 5. Got %v, %v", old, replaced)
+	}
+	if old.(*job).Linked() || !a.Linked() {
+		t.Fatal("Replace didn't swap links.")
+	}
+	if got, _ := it.Get(&job{key: 5}); got != Item(a) {
+		t.Fatal("Get didn't return replacement.")
+	}
+	checkInvariants(t, it.tree)
+
+	// Replacing the extremes must update the cached min and max.
+	first, last := &job{key: 0}, &job{key: 9}
+	it.Add(first)
+	it.Add(last)
+	if got, _ := it.First(); got != Item(first) {
+		t.Fatal("First didn't return replacement.")
+	}
+	if got, _ := it.Last(); got != Item(last) {
+		t.Fatal("Last didn't return replacement.")
+	}
+}
+
+func TestIntrusive_NextPrev(t *testing.T) {
+	it := NewIntrusive(jobComparator)
+	jobs := []*job{{key: 1}, {key: 2}, {key: 3}}
+	for _, j := range jobs {
+		it.Add(j)
+	}
+	if next, ok := it.Next(jobs[1]); !ok || next != Item(jobs[2]) {
+		t.Fatal("Next returned wrong item.")
+	}
+	if prev, ok := it.Prev(jobs[1]); !ok || prev != Item(jobs[0]) {
+		t.Fatal("Prev returned wrong item.")
+	}
+	if _, ok := it.Next(jobs[2]); ok {
+		t.Fatal("Last item had a next item.")
+	}
+	if _, ok := it.Next(&job{key: 2}); ok {
+		t.Fatal("Unlinked item had a next item.")
+	}
+}
+
+func TestIntrusive_ClearAllowsReuse(t *testing.T) {
+	it := NewIntrusive(jobComparator)
+	j := &job{key: 1}
+	it.Add(j)
+	it.Clear()
+	if j.Linked() {
+		t.Fatal("Item linked after Clear.")
+	}
+	it.Add(j)
+	if !it.Contains(j) {
+		t.Fatal("Failed to re-add item.")
+	}
+}
+
+func TestIntrusive_AddLinkedPanics(t *testing.T) {
+	it, other := NewIntrusive(jobComparator), NewIntrusive(jobComparator)
+	j := &job{key: 1}
+	it.Add(j)
+	if other.Remove(j) || other.Contains(j) {
+		t.Fatal("Item reported in wrong tree.")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic.")
+		}
+	}()
+	other.Add(j)
+}
+
+func TestIntrusive_NoAllocations(t *testing.T) {
+	it := NewIntrusive(jobComparator)
+	jobs := make([]*job, 1000)
+	for i := range jobs {
+		jobs[i] = &job{key: i}
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		for _, j := range jobs {
+			it.Add(j)
+		}
+		for _, j := range jobs {
+			it.Remove(j)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected no allocations. Got %v", allocs)
+	}
+}
+
+func BenchmarkAdd_Random_Intrusive(b *testing.B) {
+	jobs := make([]*job, startingSize+opsToBench)
+	for i := range jobs {
+		jobs[i] = &job{key: rand.Int()}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		it := NewIntrusive(jobComparator)
+		for _, j := range jobs[:startingSize] {
+			it.Add(j)
+		}
+		b.StartTimer()
+
+		// Timed section.
+		for _, j := range jobs[startingSize:] {
+			it.Add(j)
+		}
+		b.StopTimer()
+		it.Clear()
+		b.StartTimer()
+	}
+}
@@ -0,0 +1,106 @@
+package rbtree
+
+import (
+	"errors"
+)
+
+// ErrModified is reported when a tree is modified during iteration by
+// anything other than the iterator's own Remove method. ForEach panics with
+// it; an Iterator stops and returns it from Err.
+var ErrModified = errors.New("rbtree: tree modified during iteration")
+
+// Iterator steps through a tree's elements in order. Replacing an element
+// with an equal one does not disturb an iterator, but adding or removing
+// elements does, except through the iterator's own Remove method.
+//
+// A typical loop looks like:
+//
+//	it := tree.Iterator()
+//	for it.Next() {
+//		elem := it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	tree       *RBTree
+	curr       *node
+	next       *node
+	descending bool
+	modCount   int
+	err        error
+
+	// within, if set, reports whether an element is still in range.
+	within func(interface{}) bool
+}
+
+// Iterator returns an iterator over the tree's elements in sorted order.
+func (t *RBTree) Iterator() *Iterator {
+	return newIterator(t, t.min, false)
+}
+
+func newIterator(t *RBTree, first *node, descending bool) *Iterator {
+	return &Iterator{
+		tree:       t,
+		curr:       nilNode,
+		next:       first,
+		descending: descending,
+		modCount:   t.modCount,
+	}
+}
+
+// Next advances the iterator, returning false once no elements remain or the
+// tree has been modified.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.tree.modCount != it.modCount {
+		it.err = ErrModified
+		it.curr = nilNode
+		return false
+	}
+	n := it.next
+	if n == nilNode || it.within != nil && !it.within(n.elem) {
+		it.curr, it.next = nilNode, nilNode
+		return false
+	}
+	it.curr = n
+	if it.descending {
+		it.next = prevNode(n)
+	} else {
+		it.next = nextNode(n)
+	}
+	return true
+}
+
+// Value returns the current element, or nil if Next has not returned true.
+func (it *Iterator) Value() interface{} {
+	return it.curr.elem
+}
+
+// Err returns ErrModified if iteration stopped because the tree was modified,
+// and nil otherwise.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Remove removes the current element from the tree without disturbing the
+// iterator. It returns ErrModified if the tree has been modified by other
+// means, and panics if there is no current element, e.g. if Remove has
+// already been called since the last call to Next.
+func (it *Iterator) Remove() error {
+	n := it.curr
+	if n == nilNode {
+		panic("rbtree: Iterator.Remove called without a current element")
+	}
+	if it.tree.modCount != it.modCount {
+		it.err = ErrModified
+		return it.err
+	}
+	it.tree.removeNode(n)
+	it.modCount = it.tree.modCount
+	it.curr = nilNode
+	return nil
+}
@@ -0,0 +1,148 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	s := New(IntComparator)
+	it := s.Iterator()
+	if it.Next() {
+		t.Fatal("Iterator over empty set returned element.")
+	}
+	for _, v := range []int{5, 2, 8, 1, 9, 3} {
+		s.Add(v)
+	}
+	var got []interface{}
+	for it = s.Iterator(); it.Next(); {
+		got = append(got, it.Value())
+	}
+	if it.Err() != nil {
+		t.Fatalf("Unexpected error: %v", it.Err())
+	}
+	if want := []interface{}{1, 2, 3, 5, 8, 9}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v. Got %v", want, got)
+	}
+}
+
+func TestIterator_DetectsModification(t *testing.T) {
+	s := newRangeTree(0, 10)
+	it := s.Iterator()
+	it.Next()
+	s.Add(20)
+	if it.Next() {
+		t.Fatal("Iterator continued after modification.")
+	}
+	if it.Err() != ErrModified {
+		t.Fatalf("Expected ErrModified. Got %v", it.Err())
+	}
+
+	it = s.Iterator()
+	it.Next()
+	s.Remove(5)
+	if err := it.Remove(); err != ErrModified {
+		t.Fatalf("Expected ErrModified. Got %v", err)
+	}
+}
+
+func TestIterator_ReplaceIsNotModification(t *testing.T) {
+	s := newRangeTree(0, 10)
+	n := 0
+	for it := s.Iterator(); it.Next(); n++ {
+		s.Add(it.Value())
+	}
+	if n != 10 {
+		t.Fatalf("Expected 10 elements. Got %v", n)
+	}
+}
+
+func TestForEach_PanicsOnModification(t *testing.T) {
+	for name, mutate := range map[string]func(s *RBTree, e interface{}){
+		"Add":         func(s *RBTree, e interface{}) { s.Add(e.(int) + 100) },
+		"Remove":      func(s *RBTree, e interface{}) { s.Remove(e) },
+		"Clear":       func(s *RBTree, e interface{}) { s.Clear() },
+		"RemoveRange": func(s *RBTree, e interface{}) { s.RemoveRange(0, 10) },
+	} {
+		s := newRangeTree(0, 10)
+		func() {
+			defer func() {
+				if r := recover(); r != ErrModified {
+					t.Fatalf("%v: Expected ErrModified panic. Got %v", name, r)
+				}
+			}()
+			s.ForEach(func(e interface{}) { mutate(s, e) })
+		}()
+	}
+}
+
+func TestView_ForEachPanicsOnModification(t *testing.T) {
+	s := newRangeTree(0, 10)
+	defer func() {
+		if r := recover(); r != ErrModified {
+			t.Fatalf("Expected ErrModified panic. Got %v", r)
+		}
+	}()
+	s.SubSet(2, 5, true, true).ForEach(func(e interface{}) { s.Remove(e) })
+}
+
+func TestIterator_Remove(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		s := New(IntComparator)
+		for j := r.Intn(200); j > 0; j-- {
+			s.Add(r.Intn(1000))
+		}
+		want := s.ToSlice()
+		var seen, kept []interface{}
+		for it := s.Iterator(); it.Next(); {
+			seen = append(seen, it.Value())
+			if r.Intn(2) == 0 {
+				if err := it.Remove(); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			} else {
+				kept = append(kept, it.Value())
+			}
+		}
+		if !reflect.DeepEqual(seen, want) {
+			t.Fatalf("Removal disturbed iteration.\nExpected %v\nGot %v", want, seen)
+		}
+		checkInvariants(t, s)
+		if got := s.ToSlice(); !reflect.DeepEqual(got, kept) {
+			t.Fatalf("Expected %v. Got %v", kept, got)
+		}
+	}
+}
+
+func TestIterator_RemoveDescending(t *testing.T) {
+	s := newRangeTree(0, 20)
+	var seen []interface{}
+	for it := s.Descending().Iterator(); it.Next(); {
+		seen = append(seen, it.Value())
+		if it.Value().(int)%2 == 0 {
+			it.Remove()
+		}
+	}
+	if want := ints(19, -1, -1); !reflect.DeepEqual(seen, want) {
+		t.Fatalf("Expected %v. Got %v", want, seen)
+	}
+	checkInvariants(t, s)
+	if want := ints(1, 21, 2); !reflect.DeepEqual(s.ToSlice(), want) {
+		t.Fatalf("Expected %v. Got %v", want, s.ToSlice())
+	}
+}
+
+func TestIterator_RemoveTwicePanics(t *testing.T) {
+	s := newRangeTree(0, 3)
+	it := s.Iterator()
+	it.Next()
+	it.Remove()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic.")
+		}
+	}()
+	it.Remove()
+}
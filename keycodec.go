@@ -0,0 +1,68 @@
+package rbtree
+
+import (
+	"encoding/binary"
+)
+
+// KeyCodec encodes elements as fixed-width keys for a MappedSet. Encodings
+// must preserve order: for any elements a and b, the bytes.Compare of their
+// encodings must agree in sign with the tree's comparator.
+//
+// Package rbtree provides codecs for int, int64 and uint64 elements.
+type KeyCodec interface {
+	// Width returns the length of every encoded key.
+	Width() int
+	// Encode writes elem's key to dst, which has length Width().
+	Encode(dst []byte, elem interface{})
+	// Decode returns the element whose key is src.
+	Decode(src []byte) interface{}
+}
+
+// IntKeys encodes int elements as 8-byte keys.
+var IntKeys KeyCodec = intKeys{}
+
+// Int64Keys encodes int64 elements as 8-byte keys.
+var Int64Keys KeyCodec = int64Keys{}
+
+// Uint64Keys encodes uint64 elements as 8-byte keys.
+var Uint64Keys KeyCodec = uint64Keys{}
+
+// Signed values are stored big-endian with the sign bit flipped, so that
+// negative values sort before positive ones.
+const signBit = 1 << 63
+
+type intKeys struct{}
+
+func (intKeys) Width() int { return 8 }
+
+func (intKeys) Encode(dst []byte, elem interface{}) {
+	binary.BigEndian.PutUint64(dst, uint64(elem.(int))^signBit)
+}
+
+func (intKeys) Decode(src []byte) interface{} {
+	return int(binary.BigEndian.Uint64(src) ^ signBit)
+}
+
+type int64Keys struct{}
+
+func (int64Keys) Width() int { return 8 }
+
+func (int64Keys) Encode(dst []byte, elem interface{}) {
+	binary.BigEndian.PutUint64(dst, uint64(elem.(int64))^signBit)
+}
+
+func (int64Keys) Decode(src []byte) interface{} {
+	return int64(binary.BigEndian.Uint64(src) ^ signBit)
+}
+
+type uint64Keys struct{}
+
+func (uint64Keys) Width() int { return 8 }
+
+func (uint64Keys) Encode(dst []byte, elem interface{}) {
+	binary.BigEndian.PutUint64(dst, elem.(uint64))
+}
+
+func (uint64Keys) Decode(src []byte) interface{} {
+	return binary.BigEndian.Uint64(src)
+}
@@ -0,0 +1,305 @@
+package rbtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// ErrKeyOrder is returned when writing a tree whose KeyCodec doesn't preserve
+// the order, or the distinctness, of its elements.
+var ErrKeyOrder = errors.New("rbtree: encoded keys are not in strictly increasing order")
+
+// ErrNotMapped is returned when opening a file which isn't a valid mapped set.
+var ErrNotMapped = errors.New("rbtree: not a mapped set file")
+
+// A mapped set file holds, in order:
+//
+//	a header of mappedHeaderSize bytes:
+//		magic   [4]byte "RBMS"
+//		version uint32
+//		width   uint32, the length of each key
+//		stride  uint32, the number of keys per index entry
+//		count   uint64, the number of keys
+//	the index: every stride'th key, starting with the first
+//	the keys, in increasing order
+//
+// All integers are big-endian. A search first looks in the index, which is
+// small enough to stay in memory, and then in the one block of stride keys
+// that it points to, so that most searches touch only a page or two of keys.
+const (
+	mappedMagic      = "RBMS"
+	mappedVersion    = 1
+	mappedHeaderSize = 24
+	mappedStride     = 256
+)
+
+// WriteMapped writes the tree's elements to w, encoded with codec, in the
+// format read by OpenMapped. It returns ErrKeyOrder, having written nothing,
+// if codec doesn't preserve the tree's order.
+func WriteMapped(w io.Writer, t *RBTree, codec KeyCodec) error {
+	width := codec.Width()
+	if width <= 0 {
+		return fmt.Errorf("rbtree: invalid key width %d", width)
+	}
+
+	// The elements are walked once to check the keys' order before anything
+	// is written, and then once each for the index and the keys, rather than
+	// the keys being held in memory.
+	key, prev := make([]byte, width), make([]byte, width)
+	for i, n := 0, t.min; n != nilNode; i, n = i+1, nextNode(n) {
+		codec.Encode(key, n.elem)
+		if i > 0 && bytes.Compare(prev, key) >= 0 {
+			return ErrKeyOrder
+		}
+		key, prev = prev, key
+	}
+
+	bw := bufio.NewWriter(w)
+	var header [mappedHeaderSize]byte
+	copy(header[:], mappedMagic)
+	binary.BigEndian.PutUint32(header[4:], mappedVersion)
+	binary.BigEndian.PutUint32(header[8:], uint32(width))
+	binary.BigEndian.PutUint32(header[12:], mappedStride)
+	binary.BigEndian.PutUint64(header[16:], uint64(t.size))
+	bw.Write(header[:])
+	for i, n := 0, t.min; n != nilNode; i, n = i+1, nextNode(n) {
+		if i%mappedStride == 0 {
+			codec.Encode(key, n.elem)
+			bw.Write(key)
+		}
+	}
+	for n := t.min; n != nilNode; n = nextNode(n) {
+		codec.Encode(key, n.elem)
+		bw.Write(key)
+	}
+	return bw.Flush()
+}
+
+// WriteMappedFile writes the tree's elements to the named file, as
+// WriteMapped does, and syncs it to disk. The file is removed if writing
+// fails.
+func WriteMappedFile(name string, t *RBTree, codec KeyCodec) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = WriteMapped(f, t, codec)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
+
+// MappedSet is a read-only sorted set answering queries directly from a file
+// written by WriteMapped, which is memory-mapped where the platform allows
+// and read into memory otherwise. Elements are decoded only as they are
+// returned, so opening a set takes constant time regardless of its size.
+//
+// A MappedSet is safe for concurrent use until it is closed. Using it after
+// Close panics or faults.
+type MappedSet struct {
+	codec  KeyCodec
+	width  int
+	stride int
+	count  int
+	index  []byte
+	keys   []byte
+	data   []byte
+}
+
+// OpenMapped opens the named file, written by WriteMapped with a codec of
+// the same width as codec, as a MappedSet.
+func OpenMapped(name string, codec KeyCodec) (*MappedSet, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < mappedHeaderSize || size != int64(int(size)) {
+		return nil, ErrNotMapped
+	}
+	data, err := mapFile(f, int(size))
+	if err != nil {
+		return nil, err
+	}
+	s, err := newMappedSet(data, codec)
+	if err != nil {
+		unmapFile(data)
+		return nil, err
+	}
+	return s, nil
+}
+
+func newMappedSet(data []byte, codec KeyCodec) (*MappedSet, error) {
+	if string(data[:4]) != mappedMagic {
+		return nil, ErrNotMapped
+	}
+	if v := binary.BigEndian.Uint32(data[4:]); v != mappedVersion {
+		return nil, fmt.Errorf("rbtree: unsupported mapped set version %d", v)
+	}
+	width := int(binary.BigEndian.Uint32(data[8:]))
+	if width != codec.Width() {
+		return nil, fmt.Errorf("rbtree: mapped set has key width %d, codec has %d", width, codec.Width())
+	}
+	stride := int(binary.BigEndian.Uint32(data[12:]))
+	count := binary.BigEndian.Uint64(data[16:])
+	if width == 0 || stride == 0 {
+		return nil, ErrNotMapped
+	}
+	avail := uint64(len(data)-mappedHeaderSize) / uint64(width)
+	nindex := (count + uint64(stride) - 1) / uint64(stride)
+	if count > avail || nindex+count != avail || uint64(len(data)-mappedHeaderSize)%uint64(width) != 0 {
+		return nil, ErrNotMapped
+	}
+	keysAt := mappedHeaderSize + int(nindex)*width
+	return &MappedSet{
+		codec:  codec,
+		width:  width,
+		stride: stride,
+		count:  int(count),
+		index:  data[mappedHeaderSize:keysAt],
+		keys:   data[keysAt:],
+		data:   data,
+	}, nil
+}
+
+// Close releases the set's mapping.
+func (s *MappedSet) Close() error {
+	data := s.data
+	s.index, s.keys, s.data = nil, nil, nil
+	return unmapFile(data)
+}
+
+// Contains returns whether elem is in the set.
+func (s *MappedSet) Contains(elem interface{}) bool {
+	key := s.encode(elem)
+	i := s.search(key, false)
+	return i < s.count && bytes.Equal(s.key(i), key)
+}
+
+// Ceiling returns the least element greater than or equal to elem, or
+// (nil, false) if none exists.
+func (s *MappedSet) Ceiling(elem interface{}) (interface{}, bool) {
+	return s.at(s.search(s.encode(elem), false))
+}
+
+// Floor returns the greatest element less than or equal to elem, or
+// (nil, false) if none exists.
+func (s *MappedSet) Floor(elem interface{}) (interface{}, bool) {
+	return s.at(s.search(s.encode(elem), true) - 1)
+}
+
+// First returns the set's smallest element or (nil, false) if s.Size() == 0.
+func (s *MappedSet) First() (interface{}, bool) {
+	return s.at(0)
+}
+
+// Last returns the set's largest element or (nil, false) if s.Size() == 0.
+func (s *MappedSet) Last() (interface{}, bool) {
+	return s.at(s.count - 1)
+}
+
+// Size returns the number of elements in the set.
+func (s *MappedSet) Size() int {
+	return s.count
+}
+
+// IsEmpty returns whether the set is empty.
+func (s *MappedSet) IsEmpty() bool {
+	return s.count == 0
+}
+
+// ForEach iterates over the set's elements in sorted order, calling f on
+// each.
+func (s *MappedSet) ForEach(f func(interface{})) {
+	for i := 0; i < s.count; i++ {
+		f(s.codec.Decode(s.key(i)))
+	}
+}
+
+// ForEachRange iterates in sorted order over the elements in [lo, hi),
+// calling f on each until it returns false.
+func (s *MappedSet) ForEachRange(lo, hi interface{}, f func(interface{}) bool) {
+	end := s.encode(hi)
+	for i := s.search(s.encode(lo), false); i < s.count; i++ {
+		key := s.key(i)
+		if bytes.Compare(key, end) >= 0 || !f(s.codec.Decode(key)) {
+			return
+		}
+	}
+}
+
+// String returns a string representation of the set, including its
+// size and first and last elements, if they exist.
+func (s *MappedSet) String() string {
+	str := "MappedSet<"
+	str += "Size: " + strconv.Itoa(s.Size())
+	if first, exists := s.First(); exists {
+		str += ", First: " + fmt.Sprintf("%v", first)
+	}
+	if last, exists := s.Last(); exists {
+		str += ", Last: " + fmt.Sprintf("%v", last)
+	}
+	str += ">"
+	return str
+}
+
+func (s *MappedSet) encode(elem interface{}) []byte {
+	key := make([]byte, s.width)
+	s.codec.Encode(key, elem)
+	return key
+}
+
+func (s *MappedSet) key(i int) []byte {
+	return s.keys[i*s.width : (i+1)*s.width]
+}
+
+func (s *MappedSet) at(i int) (interface{}, bool) {
+	if i < 0 || i >= s.count {
+		return nil, false
+	}
+	return s.codec.Decode(s.key(i)), true
+}
+
+// search returns the index of the first key greater than or equal to key, or
+// greater than key if after is set. It returns s.count if there is none.
+func (s *MappedSet) search(key []byte, after bool) int {
+	past := func(k []byte) bool {
+		cmp := bytes.Compare(k, key)
+		return cmp > 0 || cmp == 0 && !after
+	}
+	// The first index entry past key bounds the block holding the answer.
+	nindex := len(s.index) / s.width
+	j := sort.Search(nindex, func(j int) bool {
+		return past(s.index[j*s.width : (j+1)*s.width])
+	})
+	if j == 0 {
+		return 0
+	}
+	lo := (j - 1) * s.stride
+	hi := j * s.stride
+	if hi > s.count {
+		hi = s.count
+	}
+	return lo + sort.Search(hi-lo, func(i int) bool {
+		return past(s.key(lo + i))
+	})
+}
@@ -0,0 +1,201 @@
+package rbtree
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeMappedTree writes s to a temporary file and opens it as a MappedSet.
+func writeMappedTree(t *testing.T, s *RBTree) *MappedSet {
+	name := filepath.Join(t.TempDir(), "set")
+	if err := WriteMappedFile(name, s, IntKeys); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	m, err := OpenMapped(name, IntKeys)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestMapped_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 1, 255, 256, 257, 1000, 5000} {
+		s := New(IntComparator)
+		for s.Size() < size {
+			s.Add(r.Intn(4*size) - 2*size)
+		}
+		m := writeMappedTree(t, s)
+		if m.Size() != size {
+			t.Fatalf("Expected size %v. Got %v", size, m.Size())
+		}
+		want := s.ToSlice()
+		var got []interface{}
+		m.ForEach(func(elem interface{}) {
+			got = append(got, elem)
+		})
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Size %v: ForEach returned wrong elements.", size)
+		}
+		for i := 0; i < 500; i++ {
+			v := r.Intn(4*size+2) - 2*size - 1
+			j := sort.Search(len(want), func(j int) bool { return want[j].(int) >= v })
+			if m.Contains(v) != s.Contains(v) {
+				t.Fatalf("Size %v: wrong Contains(%v).", size, v)
+			}
+			ceil, ok := m.Ceiling(v)
+			if ok != (j < size) || ok && ceil != want[j] {
+				t.Fatalf("Size %v: wrong Ceiling(%v). Got %v, %v", size, v, ceil, ok)
+			}
+			k := sort.Search(len(want), func(k int) bool { return want[k].(int) > v }) - 1
+			floor, ok := m.Floor(v)
+			if ok != (k >= 0) || ok && floor != want[k] {
+				t.Fatalf("Size %v: wrong Floor(%v). Got %v, %v", size, v, floor, ok)
+			}
+		}
+	}
+}
+
+func TestMapped_ForEachRange(t *testing.T) {
+	m := writeMappedTree(t, newRangeTree(-600, 600))
+	var got []interface{}
+	m.ForEachRange(-10, 300, func(elem interface{}) bool {
+		got = append(got, elem)
+		return true
+	})
+	if !reflect.DeepEqual(got, ints(-10, 300, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(-10, 300, 1), got)
+	}
+	got = nil
+	m.ForEachRange(0, 600, func(elem interface{}) bool {
+		got = append(got, elem)
+		return len(got) < 3
+	})
+	if !reflect.DeepEqual(got, ints(0, 3, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(0, 3, 1), got)
+	}
+	if m.String() != "MappedSet<Size: 1200, First: -600, Last: 599>" {
+		t.Fatalf("Unexpected string %v", m.String())
+	}
+}
+
+func TestWriteMapped_KeyOrder(t *testing.T) {
+	s := New(func(a, b interface{}) int { return b.(int) - a.(int) })
+	s.Add(1)
+	s.Add(2)
+	var buf bytes.Buffer
+	if err := WriteMapped(&buf, s, IntKeys); err != ErrKeyOrder {
+		t.Fatalf("Expected %v. Got %v", ErrKeyOrder, err)
+	}
+	name := filepath.Join(t.TempDir(), "set")
+	if err := WriteMappedFile(name, s, IntKeys); err != ErrKeyOrder {
+		t.Fatalf("Expected %v. Got %v", ErrKeyOrder, err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatal("Expected partially written file to be removed.")
+	}
+}
+
+// lastOutOfOrder is IntKeys, but encodes last as 0.
+type lastOutOfOrder struct {
+	KeyCodec
+	last int
+}
+
+func (c lastOutOfOrder) Encode(dst []byte, elem interface{}) {
+	if elem.(int) == c.last {
+		elem = 0
+	}
+	c.KeyCodec.Encode(dst, elem)
+}
+
+func TestWriteMapped_KeyOrderWritesNothing(t *testing.T) {
+	s := newRangeTree(0, 10000)
+	var buf bytes.Buffer
+	if err := WriteMapped(&buf, s, lastOutOfOrder{IntKeys, 9999}); err != ErrKeyOrder {
+		t.Fatalf("Expected %v. Got %v", ErrKeyOrder, err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected nothing written. Got %v bytes", buf.Len())
+	}
+}
+
+func TestOpenMapped_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMapped(&buf, newRangeTree(0, 1000), IntKeys)
+	good := buf.Bytes()
+	cases := map[string][]byte{
+		"empty":     nil,
+		"magic":     append([]byte("XXXX"), good[4:]...),
+		"truncated": good[:len(good)-1],
+		"extended":  append(append([]byte{}, good...), 0),
+	}
+	dir := t.TempDir()
+	for name, data := range cases {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0666)
+		if _, err := OpenMapped(path, IntKeys); err != ErrNotMapped {
+			t.Fatalf("%v: expected %v. Got %v", name, ErrNotMapped, err)
+		}
+	}
+	path := filepath.Join(dir, "good")
+	os.WriteFile(path, good, 0666)
+	if _, err := OpenMapped(path, widthCodec{IntKeys}); err == nil {
+		t.Fatal("Expected error opening with codec of wrong width.")
+	}
+}
+
+type widthCodec struct {
+	KeyCodec
+}
+
+func (widthCodec) Width() int { return 4 }
+
+func TestKeyCodecs_PreserveOrder(t *testing.T) {
+	ints := []interface{}{-1 << 63, -2, -1, 0, 1, 1<<63 - 1}
+	int64s := []interface{}{int64(-1 << 63), int64(-1), int64(0), int64(1 << 40)}
+	uint64s := []interface{}{uint64(0), uint64(1), uint64(1 << 63), uint64(1<<64 - 1)}
+	for _, c := range []struct {
+		codec KeyCodec
+		elems []interface{}
+	}{{IntKeys, ints}, {Int64Keys, int64s}, {Uint64Keys, uint64s}} {
+		var prev []byte
+		for _, elem := range c.elems {
+			key := make([]byte, c.codec.Width())
+			c.codec.Encode(key, elem)
+			if prev != nil && bytes.Compare(prev, key) >= 0 {
+				t.Fatalf("Key for %v doesn't sort after its predecessor.", elem)
+			}
+			if got := c.codec.Decode(key); got != elem {
+				t.Fatalf("Expected %v. Got %v", elem, got)
+			}
+			prev = key
+		}
+	}
+}
+
+func BenchmarkContains_Random_Ints_Mapped(b *testing.B) {
+	s := New(IntComparator)
+	for i := 0; i < startingSize; i++ {
+		s.Add(rand.Intn(startingSize * 2))
+	}
+	name := filepath.Join(b.TempDir(), "set")
+	WriteMappedFile(name, s, IntKeys)
+	m, err := OpenMapped(name, IntKeys)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer m.Close()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < opsToBench; j++ {
+			m.Contains(rand.Intn(startingSize * 2))
+		}
+	}
+}
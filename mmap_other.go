@@ -0,0 +1,22 @@
+//go:build !unix
+
+package rbtree
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the first size bytes of f into memory, on platforms without
+// a supported mmap.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
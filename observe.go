@@ -0,0 +1,292 @@
+package rbtree
+
+import (
+	"errors"
+	"sync"
+)
+
+// EventKind is the kind of change an Event describes.
+type EventKind int
+
+const (
+	Added EventKind = iota
+	Replaced
+	Removed
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case Added:
+		return "Added"
+	case Replaced:
+		return "Replaced"
+	case Removed:
+		return "Removed"
+	}
+	return "EventKind(?)"
+}
+
+// Event describes a change to a tree. Elem is the element added or removed,
+// or for Replaced, the element that took Old's place.
+type Event struct {
+	Kind EventKind
+	Elem interface{}
+	Old  interface{}
+}
+
+// ErrWatcherLagged is reported by a Watcher which was closed because its
+// buffer was full when an event arrived.
+var ErrWatcherLagged = errors.New("rbtree: watcher fell behind")
+
+type observers struct {
+	// Both slices are copied on write, so that a callback cancelling itself
+	// doesn't disturb the loop calling it.
+	hooks    []*hook
+	watchers []*Watcher
+
+	// While holding is set, events are collected in held rather than
+	// delivered. See holdEvents.
+	holding bool
+	held    []Event
+}
+
+type hook struct {
+	add     func(elem interface{})
+	replace func(old, elem interface{})
+	remove  func(elem interface{})
+}
+
+// OnAdd registers f to be called with each element added to the tree. It
+// returns a function which unregisters f.
+//
+// Callbacks run synchronously on the goroutine changing the tree, once the
+// change is complete, so they see the tree as it is afterwards. They may read
+// the tree but must not change it. Every change is reported, whichever method
+// makes it: bulk removals and Clear report each element removed, in order,
+// once the whole removal is done.
+//
+// A panic in a callback propagates to the caller of the method that made the
+// change, after the change has been made. The Try methods don't return it as
+// a *ComparatorPanicError, since the tree has changed.
+func (t *RBTree) OnAdd(f func(elem interface{})) (cancel func()) {
+	return t.addHook(&hook{add: f})
+}
+
+// OnReplace registers f to be called whenever an element is replaced by an
+// equal one, with the old element and its replacement. It returns a function
+// which unregisters f. f is called as OnAdd describes.
+func (t *RBTree) OnReplace(f func(old, elem interface{})) (cancel func()) {
+	return t.addHook(&hook{replace: f})
+}
+
+// OnRemove registers f to be called with each element removed from the tree,
+// including elements evicted by WithCapacity. It returns a function which
+// unregisters f. f is called as OnAdd describes.
+func (t *RBTree) OnRemove(f func(elem interface{})) (cancel func()) {
+	return t.addHook(&hook{remove: f})
+}
+
+func (t *RBTree) addHook(h *hook) func() {
+	o := t.observers()
+	o.hooks = append(o.hooks[:len(o.hooks):len(o.hooks)], h)
+	return func() {
+		o := t.obs
+		if o == nil {
+			return
+		}
+		hooks := make([]*hook, 0, len(o.hooks))
+		for _, other := range o.hooks {
+			if other != h {
+				hooks = append(hooks, other)
+			}
+		}
+		o.hooks = hooks
+		t.dropObserversIfUnused()
+	}
+}
+
+func (t *RBTree) observers() *observers {
+	if t.obs == nil {
+		t.obs = &observers{}
+	}
+	return t.obs
+}
+
+func (t *RBTree) dropObserversIfUnused() {
+	if len(t.obs.hooks) == 0 && len(t.obs.watchers) == 0 {
+		t.obs = nil
+	}
+}
+
+// notify reports e to the tree's observers. Callers check that t.obs is set
+// first, so that trees without observers pay only for that check.
+func (t *RBTree) notify(e Event) {
+	o := t.obs
+	if o.holding {
+		o.held = append(o.held, e)
+		return
+	}
+	for _, h := range o.hooks {
+		switch {
+		case e.Kind == Added && h.add != nil:
+			h.add(e.Elem)
+		case e.Kind == Replaced && h.replace != nil:
+			h.replace(e.Old, e.Elem)
+		case e.Kind == Removed && h.remove != nil:
+			h.remove(e.Elem)
+		}
+	}
+	pruned := false
+	for _, w := range o.watchers {
+		if !w.send(e) {
+			pruned = true
+		}
+	}
+	if pruned && t.obs == o {
+		watchers := make([]*Watcher, 0, len(o.watchers))
+		for _, w := range o.watchers {
+			if !w.isClosed() {
+				watchers = append(watchers, w)
+			}
+		}
+		o.watchers = watchers
+		t.dropObserversIfUnused()
+	}
+}
+
+// holdEvents collects events rather than delivering them until releaseEvents
+// is called with its result. The Try methods hold events while they recover
+// comparator panics, so that callbacks run outside that recovery, and adds
+// which evict an element hold them until the eviction is done.
+func (t *RBTree) holdEvents() (held bool) {
+	if t.obs == nil || t.obs.holding {
+		return false
+	}
+	t.obs.holding = true
+	return true
+}
+
+// releaseEvents delivers the events collected since holdEvents returned held.
+func (t *RBTree) releaseEvents(held bool) {
+	if !held {
+		return
+	}
+	o := t.obs
+	events := o.held
+	o.holding, o.held = false, nil
+	for _, e := range events {
+		if t.obs == nil {
+			return
+		}
+		t.notify(e)
+	}
+}
+
+// notifyRemoved reports the removal of each of elems, in order.
+func (t *RBTree) notifyRemoved(elems []interface{}) {
+	for _, elem := range elems {
+		t.notify(Event{Kind: Removed, Elem: elem})
+	}
+}
+
+// replaceElem replaces n's element with the equal elem, returning the old
+// one.
+func (t *RBTree) replaceElem(n *node, elem interface{}) (old interface{}) {
+	old = n.elem
+	if t.hasher != nil {
+		// Equal elements may still hash differently.
+		addSum(n, t.hash(elem)-t.hash(old))
+	}
+	n.elem = elem
+	if t.obs != nil {
+		t.notify(Event{Kind: Replaced, Elem: elem, Old: old})
+	}
+	return old
+}
+
+// Watcher delivers events for changes to the elements in a range on its
+// channel, C. Events are sent without blocking: if C's buffer is full when an
+// event arrives, the watcher is closed, C is closed, and Err returns
+// ErrWatcherLagged. A reader which sees C closed should check Err, and
+// re-read the range to resynchronize before watching again.
+//
+// C, Err and Close may be used from any goroutine.
+type Watcher struct {
+	C <-chan Event
+
+	c    chan Event
+	view *View
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// Watch returns a Watcher of changes to elements e with lo <= e < hi, whose
+// channel holds up to buffer events. Events are sent synchronously on the
+// goroutine changing the tree, once the change is complete, as OnAdd
+// describes for callbacks, but never block it: see Watcher for what happens
+// when the buffer is full.
+func (t *RBTree) Watch(lo, hi interface{}, buffer int) *Watcher {
+	return t.SubSet(lo, hi, true, false).Watch(buffer)
+}
+
+// Watch returns a Watcher of changes to elements within the view's range,
+// whose channel holds up to buffer events. Events are sent as RBTree.Watch
+// describes.
+func (v *View) Watch(buffer int) *Watcher {
+	c := make(chan Event, buffer)
+	w := &Watcher{C: c, c: c, view: v}
+	o := v.tree.observers()
+	o.watchers = append(o.watchers[:len(o.watchers):len(o.watchers)], w)
+	return w
+}
+
+// send delivers e if it lies in w's range, returning false if w is closed.
+func (w *Watcher) send(e Event) bool {
+	if w.isClosed() {
+		return false
+	}
+	if !w.view.inRange(e.Elem) {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.c <- e:
+		return true
+	default:
+		w.err = ErrWatcherLagged
+		w.closed = true
+		close(w.c)
+		return false
+	}
+}
+
+func (w *Watcher) isClosed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closed
+}
+
+// Close stops the watcher and closes C. Events already buffered can still be
+// received.
+func (w *Watcher) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.c)
+	}
+}
+
+// Err returns ErrWatcherLagged if the watcher was closed because it fell
+// behind, and nil otherwise.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
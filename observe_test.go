@@ -0,0 +1,245 @@
+package rbtree
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordEvents registers callbacks on s which append to the returned slice.
+func recordEvents(s *RBTree) *[]Event {
+	var events []Event
+	s.OnAdd(func(elem interface{}) {
+		events = append(events, Event{Kind: Added, Elem: elem})
+	})
+	s.OnReplace(func(old, elem interface{}) {
+		events = append(events, Event{Kind: Replaced, Elem: elem, Old: old})
+	})
+	s.OnRemove(func(elem interface{}) {
+		events = append(events, Event{Kind: Removed, Elem: elem})
+	})
+	return &events
+}
+
+func TestObserve_EveryChange(t *testing.T) {
+	s := New(keyedComparator)
+	events := recordEvents(s)
+	a, b, c := keyed{1, "a"}, keyed{1, "b"}, keyed{1, "c"}
+	d, e := keyed{1, "d"}, keyed{1, "e"}
+	s.Add(a)
+	s.Add(b)
+	s.Update(b, func(interface{}) interface{} { return c })
+	s.Compute(c, func(interface{}, bool) (interface{}, bool) { return d, true })
+	h := s.AddHandle(e)
+	s.RemoveHandle(h)
+	s.GetOrAdd(a)
+	s.Compute(a, func(interface{}, bool) (interface{}, bool) { return nil, false })
+	want := []Event{
+		{Kind: Added, Elem: a},
+		{Kind: Replaced, Elem: b, Old: a},
+		{Kind: Replaced, Elem: c, Old: b},
+		{Kind: Replaced, Elem: d, Old: c},
+		{Kind: Replaced, Elem: e, Old: d},
+		{Kind: Removed, Elem: e},
+		{Kind: Added, Elem: a},
+		{Kind: Removed, Elem: a},
+	}
+	if !reflect.DeepEqual(*events, want) {
+		t.Fatalf("Expected %v. Got %v", want, *events)
+	}
+}
+
+func TestObserve_BulkRemovals(t *testing.T) {
+	s := New(IntComparator, WithNodePool())
+	for i := 0; i < 20; i++ {
+		s.Add(i)
+	}
+	events := recordEvents(s)
+	removed := func() (elems []interface{}) {
+		for _, e := range *events {
+			if e.Kind != Removed {
+				t.Fatalf("Unexpected event %v", e)
+			}
+			elems = append(elems, e.Elem)
+		}
+		*events = nil
+		return
+	}
+	s.OnRemove(func(elem interface{}) {
+		// Callbacks see the tree once the whole change is complete.
+		checkInvariants(t, s)
+		if s.Contains(elem) || s.Size() != len(s.ToSlice()) {
+			t.Fatal("Callback ran before the removal was complete.")
+		}
+	})
+
+	s.Remove(0)
+	s.PopMin()
+	if got := removed(); !reflect.DeepEqual(got, ints(0, 2, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(0, 2, 1), got)
+	}
+	s.RemoveRange(5, 10)
+	if got := removed(); !reflect.DeepEqual(got, ints(5, 10, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(5, 10, 1), got)
+	}
+	s.RemoveIf(func(elem interface{}) bool { return elem.(int)%2 == 0 })
+	if got := removed(); !reflect.DeepEqual(got, []interface{}{2, 4, 10, 12, 14, 16, 18}) {
+		t.Fatalf("Expected even elements. Got %v", got)
+	}
+	s.Clear()
+	if got := removed(); !reflect.DeepEqual(got, []interface{}{3, 11, 13, 15, 17, 19}) {
+		t.Fatalf("Expected remaining elements. Got %v", got)
+	}
+}
+
+func TestObserve_IntrusiveReplace(t *testing.T) {
+	it := NewIntrusive(jobComparator)
+	var replaced []interface{}
+	it.tree.OnReplace(func(old, elem interface{}) {
+		replaced = append(replaced, old, elem)
+	})
+	a, b := &job{key: 1}, &job{key: 1}
+	it.Add(a)
+	it.Add(b)
+	if !reflect.DeepEqual(replaced, []interface{}{a, b}) {
+		t.Fatalf("Expected %v. Got %v", []interface{}{a, b}, replaced)
+	}
+}
+
+func TestObserve_Cancel(t *testing.T) {
+	s := New(IntComparator)
+	count := 0
+	var cancel func()
+	cancel = s.OnAdd(func(interface{}) {
+		count++
+		if count == 2 {
+			cancel()
+		}
+	})
+	other := 0
+	cancelOther := s.OnAdd(func(interface{}) { other++ })
+	for i := 0; i < 5; i++ {
+		s.Add(i)
+	}
+	if count != 2 || other != 5 {
+		t.Fatalf("Expected 2 and 5 calls. Got %v and %v", count, other)
+	}
+	cancelOther()
+	cancel()
+	if s.obs != nil {
+		t.Fatal("Expected observers to be dropped once all are cancelled.")
+	}
+}
+
+func TestWatch_Range(t *testing.T) {
+	s := New(IntComparator)
+	w := s.Watch(10, 20, 100)
+	for i := 0; i < 30; i += 5 {
+		s.Add(i)
+	}
+	s.Add(15)
+	s.RemoveRange(0, 30)
+	w.Close()
+	var got []Event
+	for e := range w.C {
+		got = append(got, e)
+	}
+	want := []Event{
+		{Kind: Added, Elem: 10},
+		{Kind: Added, Elem: 15},
+		{Kind: Replaced, Elem: 15, Old: 15},
+		{Kind: Removed, Elem: 10},
+		{Kind: Removed, Elem: 15},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v. Got %v", want, got)
+	}
+	if w.Err() != nil {
+		t.Fatalf("Unexpected error %v", w.Err())
+	}
+	s.Add(12)
+	if s.obs != nil {
+		t.Fatal("Expected closed watcher to be dropped.")
+	}
+}
+
+func TestWatch_Lagged(t *testing.T) {
+	s := New(IntComparator)
+	w := s.Watch(0, 100, 3)
+	keep := s.Watch(0, 100, 10)
+	for i := 0; i < 5; i++ {
+		s.Add(i)
+	}
+	var got []interface{}
+	for e := range w.C {
+		got = append(got, e.Elem)
+	}
+	if !reflect.DeepEqual(got, ints(0, 3, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(0, 3, 1), got)
+	}
+	if w.Err() != ErrWatcherLagged {
+		t.Fatalf("Expected %v. Got %v", ErrWatcherLagged, w.Err())
+	}
+	if len(keep.C) != 5 || keep.Err() != nil {
+		t.Fatal("A lagging watcher affected another.")
+	}
+}
+
+func TestWatch_Concurrent(t *testing.T) {
+	s := New(IntComparator)
+	w := s.Watch(0, 1000, 1000)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		n := 0
+		for e := range w.C {
+			if e.Elem != n {
+				t.Errorf("Expected %v. Got %v", n, e.Elem)
+				return
+			}
+			n++
+			if n == 100 {
+				w.Close()
+			}
+		}
+	}()
+	// The reader closes the watcher while the writer is still sending.
+	for i := 0; i < 1000; i++ {
+		s.Add(i)
+	}
+	wg.Wait()
+	if w.Err() != nil {
+		t.Fatalf("Unexpected error %v", w.Err())
+	}
+}
+
+func TestObserve_CallbackPanicInTry(t *testing.T) {
+	s := New(IntComparator)
+	s.OnAdd(func(interface{}) {
+		panic("callback")
+	})
+	func() {
+		defer func() {
+			if r := recover(); r != "callback" {
+				t.Fatalf("Expected the callback's panic. Got %v", r)
+			}
+		}()
+		s.TryAdd(1)
+		t.Fatal("Expected TryAdd to panic.")
+	}()
+	if !s.Contains(1) {
+		t.Fatal("Expected 1 to have been added.")
+	}
+
+	// A comparator panic is still returned as an error, with no event.
+	faulty := New(faultyComparator(1))
+	faulty.Add(1)
+	var events []interface{}
+	faulty.OnAdd(func(elem interface{}) {
+		events = append(events, elem)
+	})
+	if _, _, err := faulty.TryAdd(2); err == nil || events != nil || faulty.Size() != 1 {
+		t.Fatalf("Expected an error and no change. Got %v and %v", err, events)
+	}
+}
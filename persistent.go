@@ -0,0 +1,233 @@
+package rbtree
+
+// pnode is a node of a persistent red-black tree. pnodes are never modified
+// once built: each change copies the path from the root down to the change
+// and shares everything else with the tree it was made to. nil is an empty,
+// black leaf.
+//
+// Insertion follows Okasaki and deletion follows Kahrs, "Red-black trees with
+// types", J. Functional Programming 11(4), 2001.
+type pnode struct {
+	elem  interface{}
+	color colorT
+	left  *pnode
+	right *pnode
+}
+
+func pn(c colorT, left *pnode, elem interface{}, right *pnode) *pnode {
+	return &pnode{elem: elem, color: c, left: left, right: right}
+}
+
+func isRed(n *pnode) bool {
+	return n != nil && n.color == red
+}
+
+// Returns whether n is a black node rather than a leaf.
+func isBlackNode(n *pnode) bool {
+	return n != nil && n.color == black
+}
+
+func blacken(n *pnode) *pnode {
+	if isRed(n) {
+		return pn(black, n.left, n.elem, n.right)
+	}
+	return n
+}
+
+// pinsert returns the root of the tree holding n's elements and elem, which
+// replaces any equal element.
+func pinsert(n *pnode, elem interface{}, cmp Comparator) *pnode {
+	return blacken(pins(n, elem, cmp))
+}
+
+func pins(n *pnode, elem interface{}, cmp Comparator) *pnode {
+	if n == nil {
+		return pn(red, nil, elem, nil)
+	}
+	c := cmp(elem, n.elem)
+	switch {
+	case c < 0 && n.color == black:
+		return pbalance(pins(n.left, elem, cmp), n.elem, n.right)
+	case c < 0:
+		return pn(red, pins(n.left, elem, cmp), n.elem, n.right)
+	case c > 0 && n.color == black:
+		return pbalance(n.left, n.elem, pins(n.right, elem, cmp))
+	case c > 0:
+		return pn(red, n.left, n.elem, pins(n.right, elem, cmp))
+	default:
+		return pn(n.color, n.left, elem, n.right)
+	}
+}
+
+// pdelete returns the root of the tree holding n's elements other than the
+// one equal to elem, which must exist.
+func pdelete(n *pnode, elem interface{}, cmp Comparator) *pnode {
+	return blacken(pdel(n, elem, cmp))
+}
+
+func pdel(n *pnode, elem interface{}, cmp Comparator) *pnode {
+	if n == nil {
+		return nil
+	}
+	c := cmp(elem, n.elem)
+	switch {
+	case c < 0 && isBlackNode(n.left):
+		return pbalLeft(pdel(n.left, elem, cmp), n.elem, n.right)
+	case c < 0:
+		return pn(red, pdel(n.left, elem, cmp), n.elem, n.right)
+	case c > 0 && isBlackNode(n.right):
+		return pbalRight(n.left, n.elem, pdel(n.right, elem, cmp))
+	case c > 0:
+		return pn(red, n.left, n.elem, pdel(n.right, elem, cmp))
+	default:
+		return pappend(n.left, n.right)
+	}
+}
+
+// pbalance builds a black node from left, elem and right, rotating away any
+// red node with a red child among them.
+func pbalance(left *pnode, elem interface{}, right *pnode) *pnode {
+	switch {
+	case isRed(left) && isRed(right):
+		return pn(red, blacken(left), elem, blacken(right))
+	case isRed(left) && isRed(left.left):
+		return pn(red, blacken(left.left), left.elem, pn(black, left.right, elem, right))
+	case isRed(left) && isRed(left.right):
+		return pn(red, pn(black, left.left, left.elem, left.right.left), left.right.elem,
+			pn(black, left.right.right, elem, right))
+	case isRed(right) && isRed(right.right):
+		return pn(red, pn(black, left, elem, right.left), right.elem, blacken(right.right))
+	case isRed(right) && isRed(right.left):
+		return pn(red, pn(black, left, elem, right.left.left), right.left.elem,
+			pn(black, right.left.right, right.elem, right.right))
+	}
+	return pn(black, left, elem, right)
+}
+
+// pbalLeft joins left, elem and right when left's black height is one less
+// than right's, as after a deletion from left.
+func pbalLeft(left *pnode, elem interface{}, right *pnode) *pnode {
+	switch {
+	case isRed(left):
+		return pn(red, blacken(left), elem, right)
+	case isBlackNode(right):
+		return pbalance(left, elem, redden(right))
+	case isRed(right) && isBlackNode(right.left):
+		return pn(red, pn(black, left, elem, right.left.left), right.left.elem,
+			pbalance(right.left.right, right.elem, redden(right.right)))
+	}
+	panic("rbtree: persistent tree invariant violated")
+}
+
+// pbalRight is the mirror image of pbalLeft.
+func pbalRight(left *pnode, elem interface{}, right *pnode) *pnode {
+	switch {
+	case isRed(right):
+		return pn(red, left, elem, blacken(right))
+	case isBlackNode(left):
+		return pbalance(redden(left), elem, right)
+	case isRed(left) && isBlackNode(left.right):
+		return pn(red, pbalance(redden(left.left), left.elem, left.right.left), left.right.elem,
+			pn(black, left.right.right, elem, right))
+	}
+	panic("rbtree: persistent tree invariant violated")
+}
+
+// redden returns a red copy of n, which must be a black node.
+func redden(n *pnode) *pnode {
+	if !isBlackNode(n) {
+		panic("rbtree: persistent tree invariant violated")
+	}
+	return pn(red, n.left, n.elem, n.right)
+}
+
+// pappend joins two trees of equal black height, all of whose elements in
+// left are less than those in right.
+func pappend(left, right *pnode) *pnode {
+	switch {
+	case left == nil:
+		return right
+	case right == nil:
+		return left
+	case isRed(left) && isRed(right):
+		mid := pappend(left.right, right.left)
+		if isRed(mid) {
+			return pn(red, pn(red, left.left, left.elem, mid.left), mid.elem,
+				pn(red, mid.right, right.elem, right.right))
+		}
+		return pn(red, left.left, left.elem, pn(red, mid, right.elem, right.right))
+	case !isRed(left) && !isRed(right):
+		mid := pappend(left.right, right.left)
+		if isRed(mid) {
+			return pn(red, pn(black, left.left, left.elem, mid.left), mid.elem,
+				pn(black, mid.right, right.elem, right.right))
+		}
+		return pbalLeft(left.left, left.elem, pn(black, mid, right.elem, right.right))
+	case isRed(right):
+		return pn(red, pappend(left, right.left), right.elem, right.right)
+	default:
+		return pn(red, left.left, left.elem, pappend(left.right, right))
+	}
+}
+
+// pget returns the node holding the element equal to probe, or nil.
+func pget(n *pnode, probe interface{}, cmp Comparator) *pnode {
+	for n != nil {
+		c := cmp(probe, n.elem)
+		switch {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+// pceiling returns the node holding the least element greater than or equal
+// to elem, or nil.
+func pceiling(n *pnode, elem interface{}, cmp Comparator) *pnode {
+	var best *pnode
+	for n != nil {
+		c := cmp(elem, n.elem)
+		switch {
+		case c < 0:
+			best = n
+			n = n.left
+		case c > 0:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return best
+}
+
+// pfloor returns the node holding the greatest element less than or equal to
+// elem, or nil.
+func pfloor(n *pnode, elem interface{}, cmp Comparator) *pnode {
+	var best *pnode
+	for n != nil {
+		c := cmp(elem, n.elem)
+		switch {
+		case c < 0:
+			n = n.left
+		case c > 0:
+			best = n
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return best
+}
+
+func pforEach(n *pnode, f func(interface{})) {
+	for n != nil {
+		pforEach(n.left, f)
+		f(n.elem)
+		n = n.right
+	}
+}
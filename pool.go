@@ -0,0 +1,80 @@
+package rbtree
+
+// slabSize is the number of nodes a pooled tree allocates at once.
+const slabSize = 64
+
+// nodePool is a per-tree store of nodes for Add to reuse. Removed nodes are
+// kept on a free list, linked through rightChild. When it's empty, nodes are
+// carved out of a slab allocated slabSize nodes at a time.
+type nodePool struct {
+	free  *node
+	nfree int
+	slab  []node
+}
+
+// WithNodePool makes the tree recycle the nodes of removed elements for later
+// Adds, and allocate new nodes in batches. This suits workloads that
+// repeatedly fill and empty large trees, at the cost of Clear taking O(n) time
+// to reclaim each node. Shrink releases the pooled memory.
+//
+// Nodes referred to by a Handle are never recycled, so handles stay safe to
+// use after their element is removed.
+func WithNodePool() Option {
+	return func(t *RBTree) {
+		t.pool = &nodePool{}
+	}
+}
+
+// Shrink releases the nodes held for reuse by a tree created with
+// WithNodePool, and is a no-op otherwise. A slab is only returned to the
+// garbage collector once none of its nodes are in the tree, so memory may not
+// be released immediately.
+func (t *RBTree) Shrink() {
+	if t.pool != nil {
+		*t.pool = nodePool{}
+	}
+}
+
+// PoolSize returns the number of nodes held for reuse.
+func (t *RBTree) PoolSize() int {
+	if t.pool == nil {
+		return 0
+	}
+	return t.pool.nfree + len(t.pool.slab)
+}
+
+// newNode returns an unlinked node holding elem, from the pool if possible.
+func (t *RBTree) newNode(elem interface{}) *node {
+	p := t.pool
+	if p == nil {
+		return &node{elem: elem}
+	}
+	var n *node
+	if p.free != nil {
+		n = p.free
+		p.free = n.rightChild
+		p.nfree--
+		n.rightChild = nil
+	} else {
+		if len(p.slab) == 0 {
+			p.slab = make([]node, slabSize)
+		}
+		n = &p.slab[0]
+		p.slab = p.slab[1:]
+	}
+	n.elem = elem
+	return n
+}
+
+// freeNode marks n, which has been unlinked from the tree, as removed, and
+// returns it to the pool if there is one.
+func (t *RBTree) freeNode(n *node) {
+	markRemoved(n)
+	if p := t.pool; p != nil && !n.pinned {
+		n.elem = nil
+		n.color = black
+		n.rightChild = p.free
+		p.free = n
+		p.nfree++
+	}
+}
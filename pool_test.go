@@ -0,0 +1,127 @@
+package rbtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// boxed returns n distinct, already boxed ints, so that adding them doesn't
+// allocate.
+func boxed(n int) []interface{} {
+	elems := make([]interface{}, n)
+	for i, v := range rand.New(rand.NewSource(1)).Perm(n) {
+		elems[i] = v
+	}
+	return elems
+}
+
+func TestNodePool_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := New(IntComparator, WithNodePool())
+	want := map[int]bool{}
+	for i := 0; i < 20000; i++ {
+		v := r.Intn(500)
+		switch r.Intn(10) {
+		case 0:
+			s.Clear()
+			want = map[int]bool{}
+		case 1:
+			n := s.RemoveRange(v, v+50)
+			for j := v; j < v+50; j++ {
+				if want[j] {
+					delete(want, j)
+					n--
+				}
+			}
+			if n != 0 {
+				t.Fatal("RemoveRange removed wrong number of elements.")
+			}
+		case 2, 3, 4:
+			s.Remove(v)
+			delete(want, v)
+		default:
+			s.Add(v)
+			want[v] = true
+		}
+		if i%100 == 0 {
+			checkInvariants(t, s)
+		}
+	}
+	checkInvariants(t, s)
+	if s.Size() != len(want) {
+		t.Fatalf("Expected size %v. Got %v", len(want), s.Size())
+	}
+	s.ForEach(func(e interface{}) {
+		if !want[e.(int)] {
+			t.Fatalf("Unexpected element %v", e)
+		}
+	})
+}
+
+func TestNodePool_ReusesNodes(t *testing.T) {
+	elems := boxed(1000)
+	s := New(IntComparator, WithNodePool())
+	fill := func() {
+		for _, e := range elems {
+			s.Add(e)
+		}
+	}
+	fill()
+	s.Clear()
+	if s.PoolSize() < len(elems) {
+		t.Fatalf("Expected at least %v pooled nodes. Got %v", len(elems), s.PoolSize())
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		fill()
+		s.Clear()
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected no allocations. Got %v", allocs)
+	}
+
+	s.Shrink()
+	if s.PoolSize() != 0 {
+		t.Fatalf("Expected empty pool after Shrink. Got %v", s.PoolSize())
+	}
+	fill()
+	checkInvariants(t, s)
+}
+
+func TestNodePool_KeepsHandledNodes(t *testing.T) {
+	s := New(IntComparator, WithNodePool())
+	h := s.AddHandle(1)
+	s.RemoveHandle(h)
+	s.Add(2)
+	if h.Valid() || h.Value() != 1 {
+		t.Fatalf("Handle was recycled: valid %v, value %v", h.Valid(), h.Value())
+	}
+}
+
+func TestShrink_NoPool(t *testing.T) {
+	s := newRangeTree(0, 10)
+	s.Shrink()
+	if s.PoolSize() != 0 || s.Size() != 10 {
+		t.Fatal("Shrink changed tree without a pool.")
+	}
+}
+
+func benchFillClear(b *testing.B, opts ...Option) {
+	elems := boxed(startingSize)
+	s := New(IntComparator, opts...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, e := range elems {
+			s.Add(e)
+		}
+		s.Clear()
+	}
+}
+
+func BenchmarkFillClear(b *testing.B) {
+	benchFillClear(b)
+}
+
+func BenchmarkFillClear_NodePool(b *testing.B) {
+	benchFillClear(b, WithNodePool())
+}
@@ -0,0 +1,38 @@
+package rbtree
+
+// The methods in this file support using an RBTree as a double-ended priority
+// queue. The tree caches its smallest and largest nodes, so peeking takes
+// constant time.
+
+// PeekMin returns the smallest element, or (nil, false) if the tree is empty.
+// It is the same as First.
+func (t *RBTree) PeekMin() (interface{}, bool) {
+	return t.First()
+}
+
+// PeekMax returns the largest element, or (nil, false) if the tree is empty.
+// It is the same as Last.
+func (t *RBTree) PeekMax() (interface{}, bool) {
+	return t.Last()
+}
+
+// PopMin removes and returns the smallest element, or returns (nil, false) if
+// the tree is empty.
+func (t *RBTree) PopMin() (interface{}, bool) {
+	return t.pop(t.min)
+}
+
+// PopMax removes and returns the largest element, or returns (nil, false) if
+// the tree is empty.
+func (t *RBTree) PopMax() (interface{}, bool) {
+	return t.pop(t.max)
+}
+
+func (t *RBTree) pop(n *node) (interface{}, bool) {
+	if n == nilNode {
+		return nil, false
+	}
+	elem := n.elem
+	t.removeNode(n)
+	return elem, true
+}
@@ -0,0 +1,116 @@
+package rbtree
+
+import (
+	"container/heap"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPeekPop(t *testing.T) {
+	s := New(IntComparator)
+	if _, ok := s.PeekMin(); ok {
+		t.Fatal("Empty set had min.")
+	}
+	if _, ok := s.PopMax(); ok {
+		t.Fatal("Popped from empty set.")
+	}
+	for _, v := range []int{5, 3, 8, 1, 9} {
+		s.Add(v)
+	}
+	if min, _ := s.PeekMin(); min != 1 {
+		t.Fatalf("Expected min 1. Got %v", min)
+	}
+	if max, _ := s.PeekMax(); max != 9 {
+		t.Fatalf("Expected max 9. Got %v", max)
+	}
+	for _, want := range []int{1, 3} {
+		if got, ok := s.PopMin(); !ok || got != want {
+			t.Fatalf("Expected %v. Got %v", want, got)
+		}
+	}
+	for _, want := range []int{9, 8, 5} {
+		if got, ok := s.PopMax(); !ok || got != want {
+			t.Fatalf("Expected %v. Got %v", want, got)
+		}
+	}
+	if !s.IsEmpty() {
+		t.Fatal("Set not empty.")
+	}
+	checkInvariants(t, s)
+}
+
+func TestCachedExtremes_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := New(IntComparator)
+	for i := 0; i < 5000; i++ {
+		switch v := r.Intn(500); r.Intn(6) {
+		case 0, 1:
+			s.Add(v)
+		case 2:
+			s.Remove(v)
+		case 3:
+			s.PopMin()
+		case 4:
+			s.PopMax()
+		case 5:
+			if r.Intn(20) == 0 {
+				s.RemoveRange(v, v+r.Intn(100))
+			}
+		}
+		checkInvariants(t, s)
+	}
+}
+
+func TestHeap_PushPop(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	h := NewHeap(New(IntComparator))
+	var want []int
+	for _, v := range r.Perm(100) {
+		heap.Push(h, v)
+		want = append(want, v)
+	}
+	sort.Ints(want)
+	for _, v := range want {
+		if got := heap.Pop(h); got != v {
+			t.Fatalf("Expected %v. Got %v", v, got)
+		}
+	}
+	if h.Len() != 0 {
+		t.Fatalf("Expected empty heap. Got length %v", h.Len())
+	}
+}
+
+func TestHeap_Init(t *testing.T) {
+	s := newRangeTree(0, 10)
+	h := NewMaxHeap(s)
+	heap.Init(h)
+	for want := 9; want >= 0; want-- {
+		if got := heap.Pop(h); got != want {
+			t.Fatalf("Expected %v. Got %v", want, got)
+		}
+	}
+}
+
+func TestHeap_Remove(t *testing.T) {
+	s := newRangeTree(0, 10)
+	h := NewHeap(s)
+	if got := heap.Remove(h, 3); got != 3 {
+		t.Fatalf("Expected 3. Got %v", got)
+	}
+	if got := heap.Remove(h, h.Len()-1); got != 9 {
+		t.Fatalf("Expected 9. Got %v", got)
+	}
+	if got := heap.Remove(h, 0); got != 0 {
+		t.Fatalf("Expected 0. Got %v", got)
+	}
+	if want := []interface{}{1, 2, 4, 5, 6, 7, 8}; !reflect.DeepEqual(s.ToSlice(), want) {
+		t.Fatalf("Expected %v. Got %v", want, s.ToSlice())
+	}
+
+	m := NewMaxHeap(newRangeTree(0, 10))
+	if got := heap.Remove(m, 2); got != 7 {
+		t.Fatalf("Expected 7. Got %v", got)
+	}
+}
@@ -2,6 +2,7 @@ package rbtree
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 )
 
@@ -11,6 +12,40 @@ type RBTree struct {
 	root *node
 	cmp  Comparator
 	size int
+
+	// min and max cache the nodes holding the smallest and largest elements,
+	// or are nilNode if the tree is empty.
+	min *node
+	max *node
+
+	// modCount is incremented whenever nodes are linked into or out of the
+	// tree, so that iterators can detect such changes.
+	modCount int
+
+	// hasHandles is set once AddHandle is used, after which Clear must mark
+	// each node as removed to invalidate outstanding handles.
+	hasHandles bool
+
+	// pool, if set, recycles removed nodes. See WithNodePool.
+	pool *nodePool
+
+	// typed is set if elements are checked against elemType before use. If
+	// elemType is nil, it is inferred from the first element added.
+	typed    bool
+	elemType reflect.Type
+
+	// capacity, if not 0, limits the number of elements, with policy
+	// deciding what to evict when the tree is full. See WithCapacity.
+	capacity int
+	policy   EvictionPolicy
+
+	// hasher, if set, hashes elements for the sums kept in each node. See
+	// WithHasher.
+	hasher Hasher
+
+	// obs, if set, holds the callbacks and watchers to notify of changes. See
+	// OnAdd and Watch.
+	obs *observers
 }
 
 type colorT bool
@@ -23,6 +58,8 @@ const (
 type node struct {
 	elem       interface{}
 	color      colorT
+	pinned     bool   // set if a Handle may refer to the node
+	sum        uint64 // hash of the subtree's elements, if the tree has a hasher
 	parent     *node
 	leftChild  *node
 	rightChild *node
@@ -30,41 +67,72 @@ type node struct {
 
 var nilNode = &node{color: black}
 
+// Option configures an RBTree returned by New.
+type Option func(*RBTree)
+
 // New returns an empty RBTree which uses the given comparator.
-func New(cmp Comparator) *RBTree {
-	return &RBTree{
+func New(cmp Comparator, opts ...Option) *RBTree {
+	t := &RBTree{
 		root: nilNode,
 		cmp:  cmp,
 		size: 0,
+		min:  nilNode,
+		max:  nilNode,
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
-// Add adds an element to the tree, removing and returning any element equal to the one
-// given, or nil if none exist.
-func (t *RBTree) Add(elem interface{}) interface{} {
-	curr, parent := t.root, t.root
-	var cmp int
-	for curr != nilNode {
-		parent = curr
-		cmp = t.cmp(elem, curr.elem)
+// Add adds an element to the tree. If an element equal to the one given
+// already exists, it is replaced and returned with replaced set to true. If
+// the tree has a capacity, adding a new element may evict another or be
+// rejected; see WithCapacity and Offer.
+func (t *RBTree) Add(elem interface{}) (old interface{}, replaced bool) {
+	r := t.Offer(elem)
+	return r.Old, r.Replaced
+}
+
+// search descends from the root looking for elem. If an equal element exists,
+// its node is returned. Otherwise n is nilNode, and parent and cmp locate the
+// spot where insertAt should link elem in.
+func (t *RBTree) search(elem interface{}) (n *node, parent *node, cmp int) {
+	n, parent = t.root, t.root
+	for n != nilNode {
+		parent = n
+		cmp = t.cmp(elem, n.elem)
 		if cmp == 0 {
-			old := curr.elem
-			curr.elem = elem
-			return old
+			return n, parent, cmp
 		} else if cmp < 0 {
-			curr = curr.leftChild
+			n = n.leftChild
 		} else {
-			curr = curr.rightChild
+			n = n.rightChild
 		}
 	}
+	return n, parent, cmp
+}
+
+// insertAt links a new node holding elem in as the child of parent on the side
+// given by cmp, as found by search, and rebalances the tree.
+func (t *RBTree) insertAt(elem interface{}, parent *node, cmp int) *node {
+	toAdd := t.newNode(elem)
+	t.linkAt(toAdd, parent, cmp)
+	return toAdd
+}
 
-	toAdd := &node{
-		color:      red,
-		elem:       elem,
-		parent:     parent,
-		leftChild:  nilNode,
-		rightChild: nilNode,
+// linkAt is insertAt for a node the caller has already allocated. Only the
+// node's elem is kept; its links and color are overwritten.
+func (t *RBTree) linkAt(toAdd *node, parent *node, cmp int) {
+	t.inferElemType(toAdd.elem)
+	if t.hasher != nil {
+		toAdd.sum = t.hash(toAdd.elem)
+		addSum(parent, toAdd.sum)
 	}
+	toAdd.color = red
+	toAdd.parent = parent
+	toAdd.leftChild = nilNode
+	toAdd.rightChild = nilNode
 
 	if parent != nilNode {
 		if cmp < 0 {
@@ -74,9 +142,21 @@ func (t *RBTree) Add(elem interface{}) interface{} {
 		}
 	}
 
+	// A new node is leftmost only if it's the left child of the old leftmost
+	// node, and likewise for the rightmost.
+	if parent == nilNode || parent == t.min && cmp < 0 {
+		t.min = toAdd
+	}
+	if parent == nilNode || parent == t.max && cmp > 0 {
+		t.max = toAdd
+	}
+
 	t.rbInsertFixup(toAdd)
 	t.size += 1
-	return nil
+	t.modCount++
+	if t.obs != nil {
+		t.notify(Event{Kind: Added, Elem: toAdd.elem})
+	}
 }
 
 func (t *RBTree) rbInsertFixup(node *node) {
@@ -126,6 +206,9 @@ func getUncle(node *node) *node {
 }
 
 func (t *RBTree) rotateLeft(node *node) {
+	if t.hasher != nil {
+		rotateSums(node, node.rightChild, node.rightChild.leftChild)
+	}
 	if node == node.parent.leftChild {
 		node.parent.leftChild = node.rightChild				
 	} else if node == node.parent.rightChild {
@@ -143,6 +226,9 @@ func (t *RBTree) rotateLeft(node *node) {
 }
 
 func (t *RBTree) rotateRight(node *node) {
+	if t.hasher != nil {
+		rotateSums(node, node.leftChild, node.leftChild.rightChild)
+	}
 	if node == node.parent.leftChild {
 		node.parent.leftChild = node.leftChild
 	} else if node == node.parent.rightChild {
@@ -159,54 +245,125 @@ func (t *RBTree) rotateRight(node *node) {
 	node.parent.rightChild = node
 }
 
-// Remove removes an element from the tree, using the tree's comparator function
-// for equality determination. Returns true if an element is removed, false otherwise.
-func (t *RBTree) Remove(elem interface{}) bool {
+// Remove removes the element equal to the one given, using the tree's
+// comparator function for equality determination. It returns the removed
+// element and true, or nil and false if no such element exists.
+func (t *RBTree) Remove(elem interface{}) (removed interface{}, ok bool) {
+	if t.typed {
+		t.checkElem(elem)
+	}
 	toRemove := t.getNode(elem)
 	if toRemove == nil {
-		return false
+		return nil, false
 	}
 
-	if successor := getSuccessor(toRemove); successor != nilNode {
-		toRemove.elem = successor.elem
-		toRemove = successor
+	// As in Add, the comparator is not called past this point.
+	removed = toRemove.elem
+	t.removeNode(toRemove)
+	return removed, true
+}
+
+// removeNode unlinks toRemove from the tree and rebalances it. Other nodes
+// keep their elements, so references to them stay valid.
+func (t *RBTree) removeNode(toRemove *node) {
+	elem := toRemove.elem
+	if toRemove == t.min {
+		t.min = nextNode(toRemove)
+	}
+	if toRemove == t.max {
+		t.max = prevNode(toRemove)
+	}
+
+	// spliced is the node whose position is vacated. It's toRemove if
+	// toRemove has 1 or 0 non-nil children. Otherwise it's toRemove's
+	// successor, which is moved into toRemove's position and color. Either
+	// way, spliced's only child takes its place.
+	spliced := toRemove
+	if toRemove.leftChild != nilNode && toRemove.rightChild != nilNode {
+		spliced = getSuccessor(toRemove)
+	}
+	if t.hasher != nil {
+		// Every subtree holding toRemove loses its hash. Those between
+		// toRemove and spliced also lose spliced's, which takes toRemove's
+		// place and sum.
+		addSum(toRemove, -ownSum(toRemove))
+		if spliced != toRemove {
+			h := ownSum(spliced)
+			for n := spliced.parent; n != toRemove; n = n.parent {
+				n.sum -= h
+			}
+			spliced.sum = toRemove.sum
+		}
 	}
-	
-	// toRemove has either 1 or 0 non-nil children. Replace
-	// toRemove with its child.
 	var child *node
-	if toRemove.leftChild == nilNode {
-		child = toRemove.rightChild
+	if spliced.leftChild == nilNode {
+		child = spliced.rightChild
 	} else {
 		// child could be nilNode.
-		child = toRemove.leftChild
+		child = spliced.leftChild
 	}
-	
-	if toRemove == toRemove.parent.leftChild {
-		toRemove.parent.leftChild = child
-	} else if toRemove == toRemove.parent.rightChild {
-		toRemove.parent.rightChild = child
+	splicedColor := spliced.color
+
+	// Manually track child's parent since we never set the parent of nilNode
+	// even though its parent is conceptually spliced.parent in this case.
+	parent := spliced.parent
+	if spliced == toRemove {
+		t.replaceChild(toRemove, child)
 	} else {
-		t.root = child
-	}
-	if child != nilNode {
-		child.parent = toRemove.parent
+		if parent == toRemove {
+			parent = spliced
+		} else {
+			t.replaceChild(spliced, child)
+			spliced.rightChild = toRemove.rightChild
+			spliced.rightChild.parent = spliced
+		}
+		t.replaceChild(toRemove, spliced)
+		spliced.leftChild = toRemove.leftChild
+		spliced.leftChild.parent = spliced
+		spliced.color = toRemove.color
 	}
 
 	// Restore the tree's invariants.
-	if toRemove.color == red {
-		// toRemove is not the root. We're done.
+	if splicedColor == red {
+		// Black heights are unchanged. We're done.
 	} else if child.color == red {
-		// toRemove is not the root. It's black and child is red. 
+		// A black node was spliced out and child is red.
 		child.color = black
 	} else {
-		// Manually pass in parent since we never set the parent of nilNode
-		// even though its parent is conceptually toRemove.parent in this case
-		t.rbRemoveFixup(child, toRemove.parent)
+		t.rbRemoveFixup(child, parent)
 	}
-	
+
+	t.freeNode(toRemove)
 	t.size -= 1
-	return true
+	t.modCount++
+	if t.obs != nil {
+		t.notify(Event{Kind: Removed, Elem: elem})
+	}
+}
+
+// replaceChild puts n in old's position under old's parent, or at the root.
+func (t *RBTree) replaceChild(old *node, n *node) {
+	if old == old.parent.leftChild {
+		old.parent.leftChild = n
+	} else if old == old.parent.rightChild {
+		old.parent.rightChild = n
+	} else {
+		t.root = n
+	}
+	setParent(n, old.parent)
+}
+
+// markRemoved clears the links of a node that is no longer in a tree. A nil
+// parent distinguishes it from a root, whose parent is nilNode.
+func markRemoved(n *node) {
+	n.parent = nil
+	n.leftChild = nil
+	n.rightChild = nil
+}
+
+// Returns whether n is still linked into a tree.
+func (n *node) linked() bool {
+	return n.parent != nil
 }
 
 func getSuccessor(n *node) *node {
@@ -300,9 +457,25 @@ func (t *RBTree) rbRemoveFixup(child *node, parent *node) {
 
 // Contains uses the tree's comparator to check if the given element exists.
 func (t *RBTree) Contains(elem interface{}) bool {
+	if t.typed {
+		t.checkElem(elem)
+	}
 	return t.getNode(elem) != nil
 }
 
+// Get returns the stored element equal to probe and true, or nil and false
+// if none exists. This is useful when equal elements carry differing data,
+// e.g. when the comparator only looks at a key.
+func (t *RBTree) Get(probe interface{}) (interface{}, bool) {
+	if t.typed {
+		t.checkElem(probe)
+	}
+	if n := t.getNode(probe); n != nil {
+		return n.elem, true
+	}
+	return nil, false
+}
+
 // Returns nil if no node with the given element exists.
 func (t *RBTree) getNode(elem interface{}) *node {
 	curr := t.root
@@ -319,28 +492,106 @@ func (t *RBTree) getNode(elem interface{}) *node {
 	return nil
 }
 
+// ceilingNode returns the node holding the least element greater than elem,
+// or equal to it if inclusive is set. It returns nilNode if none exists.
+func (t *RBTree) ceilingNode(elem interface{}, inclusive bool) *node {
+	best, curr := nilNode, t.root
+	for curr != nilNode {
+		cmp := t.cmp(elem, curr.elem)
+		if cmp == 0 && inclusive {
+			return curr
+		} else if cmp < 0 {
+			best = curr
+			curr = curr.leftChild
+		} else {
+			curr = curr.rightChild
+		}
+	}
+	return best
+}
+
+// floorNode returns the node holding the greatest element less than elem,
+// or equal to it if inclusive is set. It returns nilNode if none exists.
+func (t *RBTree) floorNode(elem interface{}, inclusive bool) *node {
+	best, curr := nilNode, t.root
+	for curr != nilNode {
+		cmp := t.cmp(elem, curr.elem)
+		if cmp == 0 && inclusive {
+			return curr
+		} else if cmp > 0 {
+			best = curr
+			curr = curr.rightChild
+		} else {
+			curr = curr.leftChild
+		}
+	}
+	return best
+}
+
 // First returns the tree's smallest element or (nil, false) if t.Size() == 0.
+// It takes constant time.
 func (t *RBTree) First() (interface{}, bool) {
-	if t.root == nilNode {
+	if t.min == nilNode {
 		return nil, false
 	}
-	curr := t.root
-	for curr.leftChild != nilNode {
-		curr = curr.leftChild
-	}
-	return curr, true
+	return t.min.elem, true
 }
 
 // Last returns the tree's largest element or (nil, false) if t.Size() == 0.
+// It takes constant time.
 func (t *RBTree) Last() (interface{}, bool) {
-	if t.root == nilNode {
+	if t.max == nilNode {
 		return nil, false
 	}
-	curr := t.root
-	for curr.rightChild != nilNode {
-		curr = curr.rightChild
+	return t.max.elem, true
+}
+
+// resetExtremes recomputes the cached min and max nodes after the tree has
+// been rebuilt.
+func (t *RBTree) resetExtremes() {
+	if t.root == nilNode {
+		t.min, t.max = nilNode, nilNode
+		return
+	}
+	t.min, t.max = minNode(t.root), maxNode(t.root)
+}
+
+// Returns the leftmost node in n's subtree. n must not be nilNode.
+func minNode(n *node) *node {
+	for n.leftChild != nilNode {
+		n = n.leftChild
+	}
+	return n
+}
+
+// Returns the rightmost node in n's subtree. n must not be nilNode.
+func maxNode(n *node) *node {
+	for n.rightChild != nilNode {
+		n = n.rightChild
 	}
-	return curr, true
+	return n
+}
+
+// Returns the node following n in order, or nilNode if n is the last.
+func nextNode(n *node) *node {
+	if n.rightChild != nilNode {
+		return minNode(n.rightChild)
+	}
+	for n.parent != nilNode && n == n.parent.rightChild {
+		n = n.parent
+	}
+	return n.parent
+}
+
+// Returns the node preceding n in order, or nilNode if n is the first.
+func prevNode(n *node) *node {
+	if n.leftChild != nilNode {
+		return maxNode(n.leftChild)
+	}
+	for n.parent != nilNode && n == n.parent.leftChild {
+		n = n.parent
+	}
+	return n.parent
 }
 
 // Size returns the number of elements in the tree.
@@ -354,23 +605,19 @@ func (t *RBTree) IsEmpty() bool {
 }
 
 // ForEach iterates over the tree's elements in sorted order, calling f
-// on each. Be wary that it uses a recursive in-order traversal.
+// on each. It panics with ErrModified if f adds or removes elements; use an
+// Iterator to remove elements during iteration.
 func (t *RBTree) ForEach(f func(interface{})) {
-	t.forEach(t.root, f)
-}
-
-func (t *RBTree) forEach(n *node, f func(interface{})) {
-	if n == nilNode {
-		return
+	it := t.Iterator()
+	for it.Next() {
+		f(it.Value())
+	}
+	if err := it.Err(); err != nil {
+		panic(err)
 	}
-
-	t.forEach(n.leftChild, f)
-	f(n.elem)
-	t.forEach(n.rightChild, f)
 }
 
-// ToSlice returns the tree's elements in a sorted slice. Be wary that it
-// uses a recursive in-order traversal.
+// ToSlice returns the tree's elements in a sorted slice.
 func (t *RBTree) ToSlice() (s []interface{}) {
 	t.ForEach(func(a interface{}) {
 		s = append(s, a)
@@ -380,8 +627,20 @@ func (t *RBTree) ToSlice() (s []interface{}) {
 
 // Clear removes all elements. 
 func (t *RBTree) Clear() {
+	var removed []interface{}
+	if t.obs != nil {
+		removed = t.ToSlice()
+	}
+	if t.hasHandles || t.pool != nil {
+		t.unlinkAll(t.root)
+	}
 	t.root = nilNode
+	t.min, t.max = nilNode, nilNode
 	t.size = 0
+	t.modCount++
+	if t.obs != nil {
+		t.notifyRemoved(removed)
+	}
 }
 
 // String returns a string representation of the tree, including its
@@ -2,6 +2,7 @@ package rbtree
 
 import (
 	"math/rand"
+	"reflect"
 	"sort"
 	"testing"
 	"time"
@@ -11,8 +12,8 @@ func TestAdd_SortedOrder(t *testing.T) {
 	s := New(IntComparator)
 	elems := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
 	for _, v := range elems {
-		res := s.Add(v)
-		if res != nil {
+		res, replaced := s.Add(v)
+		if replaced {
 			t.Fatalf("Unexpected return: %v", res)
 		}
 	}
@@ -29,8 +30,8 @@ func TestAdd_UnsortedOrder(t *testing.T) {
 	s := New(IntComparator)
 	elems := []int{80, 15, 30, 10, 1, 2, 90, 7, 23, 26, 83}
 	for _, v := range elems {
-		res := s.Add(v)
-		if res != nil {
+		res, replaced := s.Add(v)
+		if replaced {
 			t.Fatalf("Unexpected return: %v", res)
 		}
 	}
@@ -45,8 +46,8 @@ func TestAdd_Alternating(t *testing.T) {
 	s := New(IntComparator)
 	elems := []int{100, 50, 150, 75, 125, 25, 175, 40, 160, 10, 190}
 	for _, v := range elems {
-		res := s.Add(v)
-		if res != nil {
+		res, replaced := s.Add(v)
+		if replaced {
 			t.Fatalf("Unexpected return: %v", res)
 		}
 	}
@@ -61,8 +62,8 @@ func TestAdd_LeftTree(t *testing.T) {
 	s := New(IntComparator)
 	elems := []int{100, 50, 75, 25, 20, 40, 15, 30, 10, 5}
 	for _, v := range elems {
-		res := s.Add(v)
-		if res != nil {
+		res, replaced := s.Add(v)
+		if replaced {
 			t.Fatalf("Unexpected return: %v", res)
 		}
 	}
@@ -77,8 +78,8 @@ func TestAdd_RightTree(t *testing.T) {
 	s := New(IntComparator)
 	elems := []int{100, 150, 125, 175, 160, 180, 140, 155, 190}
 	for _, v := range elems {
-		res := s.Add(v)
-		if res != nil {
+		res, replaced := s.Add(v)
+		if replaced {
 			t.Fatalf("Unexpected return: %v", res)
 		}
 	}
@@ -92,8 +93,8 @@ func TestAdd_RightTree(t *testing.T) {
 func TestAdd_DuplicateElement(t *testing.T) {
 	s := New(IntComparator)
 	s.Add(1)
-	old := s.Add(1)
-	if old != 1 {
+	old, replaced := s.Add(1)
+	if !replaced || old != 1 {
 		t.Fatal("Add duplicate did not return old element.")
 	}
 	if s.Size() != 1 {
@@ -101,12 +102,56 @@ func TestAdd_DuplicateElement(t *testing.T) {
 	}
 }
 
+// keyed is used to test that the stored element, rather than the probe, is
+// returned when the comparator only looks at part of an element.
+type keyed struct {
+	key int
+	val string
+}
+
+var keyedComparator Comparator = func(a, b interface{}) int {
+	return a.(keyed).key - b.(keyed).key
+}
+
+func TestAdd_ReplacedNil(t *testing.T) {
+	// nil sorts before everything else.
+	cmp := func(a, b interface{}) int {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		case b == nil:
+			return 1
+		}
+		return IntComparator(a, b)
+	}
+	s := New(cmp)
+	s.Add(nil)
+	old, replaced := s.Add(nil)
+	if !replaced || old != nil {
+		t.Fatalf("Expected (nil, true). Got (%v, %v)", old, replaced)
+	}
+}
+
+func TestAdd_ReturnsReplacedElement(t *testing.T) {
+	s := New(keyedComparator)
+	s.Add(keyed{1, "a"})
+	old, replaced := s.Add(keyed{1, "b"})
+	if !replaced || old != (keyed{1, "a"}) {
+		t.Fatalf("Expected ({1 a}, true). Got (%v, %v)", old, replaced)
+	}
+	if got, _ := s.Get(keyed{key: 1}); got != (keyed{1, "b"}) {
+		t.Fatalf("Expected {1 b}. Got %v", got)
+	}
+}
+
 // --Root removals-----
 
 func TestRemove_RootIsOnlyElem(t *testing.T) {
 	s := New(StringComparator)
 	s.Add("abc")
-	if !s.Remove("abc") {
+	if _, ok := s.Remove("abc"); !ok {
 		t.Fatal("Failed to remove abc.")
 	}
 	if s.Size() != 0 {
@@ -121,7 +166,7 @@ func TestRemove_RootHasRightChild(t *testing.T) {
 	s := New(StringComparator)
 	s.Add("a")
 	s.Add("b")
-	if !s.Remove("a") {
+	if _, ok := s.Remove("a"); !ok {
 		t.Fatal("Failed to remove a.")
 	}
 	if s.Size() != 1 {
@@ -140,7 +185,7 @@ func TestRemove_RootHasRightChildWithLeftChild(t *testing.T) {
 	s.Add("b")
 	s.Add("d")
 	s.Add("c")
-	if !s.Remove("b") {
+	if _, ok := s.Remove("b"); !ok {
 		t.Fatal("Failed to remove b.")
 	}
 	if s.Size() != 2 {
@@ -162,7 +207,7 @@ func TestRemove_RootHasLeftAndRightChildren(t *testing.T) {
 	s.Add("b")
 	s.Add("a")
 	s.Add("c")
-	if !s.Remove("b") {
+	if _, ok := s.Remove("b"); !ok {
 		t.Fatal("Failed to remove b.")
 	}
 	if s.Size() != 2 {
@@ -184,7 +229,7 @@ func TestRemove_NonRootLeaf(t *testing.T) {
 	s.Add("a")
 	s.Add("c")
 	s.Add("d")
-	if !s.Remove("d") {
+	if _, ok := s.Remove("d"); !ok {
 		t.Fatal("Failed to remove non-root leaf.")
 	}
 	if s.Size() != 2 {
@@ -195,7 +240,7 @@ func TestRemove_NonRootLeaf(t *testing.T) {
 	}
 
 	s.Add("b")
-	if !s.Remove("b") {
+	if _, ok := s.Remove("b"); !ok {
 		t.Fatal("Failed to remove non-root leaf.")
 	}
 	if s.Size() != 2 {
@@ -213,7 +258,7 @@ func TestRemove_Bulk(t *testing.T) {
 		s.Add(v)
 	}
 	for i, v := range elems {
-		if !s.Remove(v) {
+		if _, ok := s.Remove(v); !ok {
 			t.Fatalf("Failed to remove %v", v)
 		}
 		if s.Contains(v) {
@@ -239,7 +284,7 @@ func TestRemove_LeftTree(t *testing.T) {
 		s.Add(v)
 	}
 	for _, v := range leftTree {
-		if !s.Remove(v) {
+		if _, ok := s.Remove(v); !ok {
 			t.Fatalf("Failed to remove %v", v)
 		}
 		if s.Contains(v) {
@@ -256,7 +301,7 @@ func TestRemove_RightTree(t *testing.T) {
 		s.Add(v)
 	}
 	for _, v := range rightTree {
-		if !s.Remove(v) {
+		if _, ok := s.Remove(v); !ok {
 			t.Fatalf("Failed to remove %v", v)
 		}
 		if s.Contains(v) {
@@ -269,6 +314,58 @@ func TestContains(t *testing.T) {
 	// Tested implicitly.
 }
 
+func TestRemove_ReturnsStoredElement(t *testing.T) {
+	s := New(keyedComparator)
+	for i, v := range []string{"a", "b", "c", "d", "e"} {
+		s.Add(keyed{i, v})
+	}
+	// Removing an interior node moves its successor into its place; make sure
+	// the returned element is the one that was asked for.
+	removed, ok := s.Remove(keyed{key: 1})
+	if !ok || removed != (keyed{1, "b"}) {
+		t.Fatalf("Expected ({1 b}, true). Got (%v, %v)", removed, ok)
+	}
+	removed, ok = s.Remove(keyed{key: 1})
+	if ok || removed != nil {
+		t.Fatalf("Expected (nil, false). Got (%v, %v)", removed, ok)
+	}
+}
+
+func TestGet(t *testing.T) {
+	s := New(keyedComparator)
+	if got, found := s.Get(keyed{key: 1}); found || got != nil {
+		t.Fatalf("Expected (nil, false). Got (%v, %v)", got, found)
+	}
+	for i, v := range []string{"a", "b", "c"} {
+		s.Add(keyed{i, v})
+	}
+	for i, v := range []string{"a", "b", "c"} {
+		got, found := s.Get(keyed{key: i})
+		if !found || got != (keyed{i, v}) {
+			t.Fatalf("Expected (%v, true). Got (%v, %v)", keyed{i, v}, got, found)
+		}
+	}
+}
+
+func TestFirstLast(t *testing.T) {
+	s := New(IntComparator)
+	if _, exists := s.First(); exists {
+		t.Fatal("Empty set had first element.")
+	}
+	if _, exists := s.Last(); exists {
+		t.Fatal("Empty set had last element.")
+	}
+	for _, v := range []int{5, 3, 8, 1, 9, 4} {
+		s.Add(v)
+	}
+	if first, exists := s.First(); !exists || first != 1 {
+		t.Fatalf("Expected 1. Got %v", first)
+	}
+	if last, exists := s.Last(); !exists || last != 9 {
+		t.Fatalf("Expected 9. Got %v", last)
+	}
+}
+
 func TestSize(t *testing.T) {
 	s := New(IntComparator)
 	elems := []int{20, 70, 900, 1500, 4000, 80, 17, 16, 15, 14, 91}
@@ -365,6 +462,57 @@ func TestClear(t *testing.T) {
 	}
 }
 
+// checkInvariants fails the test if s violates a red-black or binary search
+// tree invariant, or if its size is out of date.
+func checkInvariants(t *testing.T, s *RBTree) {
+	t.Helper()
+	if s.root.color != black {
+		t.Fatal("Root is red.")
+	}
+	if s.root != nilNode && s.root.parent != nilNode {
+		t.Fatal("Root has a parent.")
+	}
+	count := 0
+	var prev interface{}
+	var walk func(n *node) int
+	walk = func(n *node) int {
+		if n == nilNode {
+			return 1
+		}
+		if n.color == red && (n.leftChild.color == red || n.rightChild.color == red) {
+			t.Fatalf("Red node %v has a red child.", n.elem)
+		}
+		if n.leftChild != nilNode && n.leftChild.parent != n ||
+			n.rightChild != nilNode && n.rightChild.parent != n {
+			t.Fatalf("Child of %v has wrong parent.", n.elem)
+		}
+		if s.hasher != nil && n.sum != s.hash(n.elem)+n.leftChild.sum+n.rightChild.sum {
+			t.Fatalf("Sum of %v is out of date.", n.elem)
+		}
+		lh := walk(n.leftChild)
+		if count > 0 && s.cmp(prev, n.elem) >= 0 {
+			t.Fatalf("%v is out of order after %v.", n.elem, prev)
+		}
+		prev = n.elem
+		count++
+		if rh := walk(n.rightChild); lh != rh {
+			t.Fatalf("Black height differs below %v.", n.elem)
+		}
+		if n.color == black {
+			lh++
+		}
+		return lh
+	}
+	walk(s.root)
+	if s.root == nilNode && (s.min != nilNode || s.max != nilNode) ||
+		s.root != nilNode && (s.min != minNode(s.root) || s.max != maxNode(s.root)) {
+		t.Fatal("Cached min or max is out of date.")
+	}
+	if count != s.Size() {
+		t.Fatalf("Size is %v, but tree holds %v elements.", s.Size(), count)
+	}
+}
+
 // --Benchmarks-----
 
 const startingSize = 50000 // Size of the tree before timing any ops.
@@ -443,3 +591,20 @@ func BenchmarkRemove_Random_Ints(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkAdd_Random_Ints_Typed(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		s := New(IntComparator, WithElemType(reflect.TypeOf(0)))
+		rand.Seed(time.Now().UTC().UnixNano())
+		for j := 0; j < startingSize; j++ {
+			s.Add(rand.Int())
+		}
+		b.StartTimer()
+
+		// Timed section.
+		for j := 0; j < opsToBench; j++ {
+			s.Add(rand.Int())
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package rbtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// ErrProtocol is returned when a reconciliation peer sends a malformed or
+// unexpected message.
+var ErrProtocol = errors.New("rbtree: reconcile protocol error")
+
+// Reconcile compares two trees created with equivalent comparators and
+// hashers (see WithHasher), and returns the elements of remote which local
+// lacks and those of local which remote lacks, each in sorted order. Neither
+// tree is changed.
+//
+// Rather than comparing every element, it compares the hashes of ranges of
+// elements, starting with the whole tree. A range whose hashes differ is split
+// around the element of local's nearest the root of its tree within the range,
+// and the parts either side compared in turn, until one side of a range is
+// empty. Finding d differences in trees of n elements compares O(d log n)
+// ranges, in O(log n) rounds.
+//
+// Elements which compare equal but hash differently, such as two versions of
+// a record, are returned in both lists.
+func Reconcile(local, remote *RBTree) (missingLocal, missingRemote []interface{}) {
+	// A local peer never fails.
+	missingLocal, missingRemote, _ = reconcile(local, treePeer{remote})
+	return missingLocal, missingRemote
+}
+
+// ReconcileRemote is Reconcile with a remote tree served by ServeReconcile on
+// the other end of rw. Elements and range bounds are sent using codec. It
+// sends the peer a request to stop serving once done.
+func ReconcileRemote(local *RBTree, rw io.ReadWriter, codec Codec) (missingLocal, missingRemote []interface{}, err error) {
+	p := &remotePeer{w: rw, r: bufio.NewReader(rw), codec: codec}
+	missingLocal, missingRemote, err = reconcile(local, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := p.send(opDone, nil); err != nil {
+		return nil, nil, err
+	}
+	return missingLocal, missingRemote, nil
+}
+
+// ServeReconcile answers the requests of a ReconcileRemote call on the other
+// end of rw about t, until that call finishes or rw reaches EOF. t must not
+// be changed meanwhile.
+//
+// Elements decoded from the peer are passed to t's comparator. If the codec
+// or the comparator panics on one, as for a payload of the wrong type,
+// ServeReconcile returns ErrProtocol.
+func ServeReconcile(t *RBTree, rw io.ReadWriter, codec Codec) (err error) {
+	t.mustHash()
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrProtocol
+		}
+	}()
+	r := bufio.NewReader(rw)
+	p := treePeer{t}
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if op == opDone {
+			return nil
+		} else if op != opHashes && op != opElements {
+			return ErrProtocol
+		}
+		ranges, err := readRanges(r, t, codec)
+		if err != nil {
+			return err
+		}
+		var resp bytes.Buffer
+		switch op {
+		case opHashes:
+			hashes, _ := p.hashes(ranges)
+			for _, h := range hashes {
+				var b [9]byte
+				binary.BigEndian.PutUint64(b[:], h.sum)
+				if h.empty {
+					b[8] = 1
+				}
+				resp.Write(b[:])
+			}
+		case opElements:
+			elems, _ := p.elements(ranges)
+			for _, elems := range elems {
+				putUvarint(&resp, uint64(len(elems)))
+				for _, elem := range elems {
+					if err := putElem(&resp, codec, elem); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if _, err := rw.Write(resp.Bytes()); err != nil {
+			return err
+		}
+	}
+}
+
+// Loopback returns the two ends of an in-memory, synchronous connection, for
+// running ReconcileRemote and ServeReconcile in one process. Writes to one
+// end block until read from the other. Closing either end closes both.
+func Loopback() (io.ReadWriteCloser, io.ReadWriteCloser) {
+	ar, bw := io.Pipe()
+	br, aw := io.Pipe()
+	return &pipeConn{ar, aw}, &pipeConn{br, bw}
+}
+
+type pipeConn struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func (c *pipeConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *pipeConn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+func (c *pipeConn) Close() error {
+	c.r.Close()
+	return c.w.Close()
+}
+
+// rangeHash is a peer's summary of the elements in a range.
+type rangeHash struct {
+	sum   uint64
+	empty bool
+}
+
+// peer is the other side of a reconciliation. Ranges are given as views of
+// the local tree, and stand for the same bounds in the peer's.
+type peer interface {
+	hashes(ranges []*View) ([]rangeHash, error)
+	elements(ranges []*View) ([][]interface{}, error)
+}
+
+func reconcile(local *RBTree, p peer) (missingLocal, missingRemote []interface{}, err error) {
+	local.mustHash()
+	level := []*View{{tree: local}}
+	for len(level) > 0 {
+		remote, err := p.hashes(level)
+		if err != nil {
+			return nil, nil, err
+		}
+		var next, fetch []*View
+		for i, v := range level {
+			n := v.lowNode()
+			switch {
+			case remote[i].sum == v.Hash() && remote[i].empty == (n == nilNode):
+			case n == nilNode:
+				fetch = append(fetch, v)
+			case remote[i].empty:
+				missingRemote = append(missingRemote, v.ToSlice()...)
+			case isPoint(v):
+				// The element is in both trees, in different versions.
+				fetch = append(fetch, v)
+				missingRemote = append(missingRemote, n.elem)
+			default:
+				next = append(next, v.split(v.pivot())...)
+			}
+		}
+		if len(fetch) > 0 {
+			fetched, err := p.elements(fetch)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, elems := range fetched {
+				missingLocal = append(missingLocal, elems...)
+			}
+		}
+		level = next
+	}
+	sortElems(local, missingLocal)
+	sortElems(local, missingRemote)
+	return missingLocal, missingRemote, nil
+}
+
+func sortElems(t *RBTree, elems []interface{}) {
+	sort.Slice(elems, func(i, j int) bool {
+		return t.cmp(elems[i], elems[j]) < 0
+	})
+}
+
+// pivot returns the highest node in the tree within the view's range, which
+// must not be empty.
+func (v *View) pivot() *node {
+	n := v.tree.root
+	for {
+		if !v.aboveLo(n.elem) {
+			n = n.rightChild
+		} else if !v.belowHi(n.elem) {
+			n = n.leftChild
+		} else {
+			return n
+		}
+	}
+}
+
+// split divides the view's range into the parts below, at and above p. Since
+// p is the highest node in the range, the other parts' pivots lie below it,
+// so repeated splitting ends.
+func (v *View) split(p *node) []*View {
+	below, at, above := *v, *v, *v
+	below.hi, below.hasHi, below.hiInclusive = p.elem, true, false
+	at.lo, at.hasLo, at.loInclusive = p.elem, true, true
+	at.hi, at.hasHi, at.hiInclusive = p.elem, true, true
+	above.lo, above.hasLo, above.loInclusive = p.elem, true, false
+	return []*View{&below, &at, &above}
+}
+
+// isPoint returns whether v's range holds only its bounds' element.
+func isPoint(v *View) bool {
+	return v.hasLo && v.hasHi && v.loInclusive && v.hiInclusive && v.tree.cmp(v.lo, v.hi) == 0
+}
+
+// treePeer is a peer tree in the same process.
+type treePeer struct {
+	t *RBTree
+}
+
+// on returns v's range over p's tree.
+func (p treePeer) on(v *View) *View {
+	w := *v
+	w.tree = p.t
+	return &w
+}
+
+func (p treePeer) hashes(ranges []*View) ([]rangeHash, error) {
+	p.t.mustHash()
+	hashes := make([]rangeHash, len(ranges))
+	for i, v := range ranges {
+		w := p.on(v)
+		hashes[i] = rangeHash{sum: w.Hash(), empty: w.lowNode() == nilNode}
+	}
+	return hashes, nil
+}
+
+func (p treePeer) elements(ranges []*View) ([][]interface{}, error) {
+	elems := make([][]interface{}, len(ranges))
+	for i, v := range ranges {
+		elems[i] = p.on(v).ToSlice()
+	}
+	return elems, nil
+}
+
+// The wire protocol consists of requests, each a single byte op followed by
+// a list of ranges, answered with one result per range. A range is a byte of
+// flags and its bounds, each encoded by the codec and prefixed with its
+// length. Lengths and counts are uvarints.
+const (
+	opHashes   = 1 // answered with an 8 byte hash and an empty flag byte
+	opElements = 2 // answered with a count and that many elements
+	opDone     = 3 // not answered
+)
+
+const (
+	rangeHasLo = 1 << iota
+	rangeLoInclusive
+	rangeHasHi
+	rangeHiInclusive
+)
+
+// maxFieldSize bounds the length of an encoded element, so that a corrupt
+// length can't cause a huge allocation.
+const maxFieldSize = 1 << 28
+
+// remotePeer is a peer tree reached through ServeReconcile.
+type remotePeer struct {
+	w     io.Writer
+	r     *bufio.Reader
+	codec Codec
+}
+
+func (p *remotePeer) hashes(ranges []*View) ([]rangeHash, error) {
+	if err := p.send(opHashes, ranges); err != nil {
+		return nil, err
+	}
+	hashes := make([]rangeHash, len(ranges))
+	var b [9]byte
+	for i := range hashes {
+		if _, err := io.ReadFull(p.r, b[:]); err != nil {
+			return nil, protocolErr(err)
+		}
+		if b[8] > 1 {
+			return nil, ErrProtocol
+		}
+		hashes[i] = rangeHash{sum: binary.BigEndian.Uint64(b[:]), empty: b[8] == 1}
+	}
+	return hashes, nil
+}
+
+func (p *remotePeer) elements(ranges []*View) ([][]interface{}, error) {
+	if err := p.send(opElements, ranges); err != nil {
+		return nil, err
+	}
+	elems := make([][]interface{}, len(ranges))
+	for i := range elems {
+		count, err := binary.ReadUvarint(p.r)
+		if err != nil {
+			return nil, protocolErr(err)
+		}
+		for ; count > 0; count-- {
+			elem, err := readElem(p.r, p.codec)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = append(elems[i], elem)
+		}
+	}
+	return elems, nil
+}
+
+// send writes a request in a single Write.
+func (p *remotePeer) send(op byte, ranges []*View) error {
+	var b bytes.Buffer
+	b.WriteByte(op)
+	if op != opDone {
+		putUvarint(&b, uint64(len(ranges)))
+		for _, v := range ranges {
+			if err := putRange(&b, p.codec, v); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := p.w.Write(b.Bytes())
+	return err
+}
+
+func putRange(b *bytes.Buffer, codec Codec, v *View) error {
+	var flags byte
+	if v.hasLo {
+		flags |= rangeHasLo
+	}
+	if v.loInclusive {
+		flags |= rangeLoInclusive
+	}
+	if v.hasHi {
+		flags |= rangeHasHi
+	}
+	if v.hiInclusive {
+		flags |= rangeHiInclusive
+	}
+	b.WriteByte(flags)
+	if v.hasLo {
+		if err := putElem(b, codec, v.lo); err != nil {
+			return err
+		}
+	}
+	if v.hasHi {
+		if err := putElem(b, codec, v.hi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRanges reads a count and that many ranges, as views of t.
+func readRanges(r *bufio.Reader, t *RBTree, codec Codec) ([]*View, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, protocolErr(err)
+	}
+	var ranges []*View
+	for ; count > 0; count-- {
+		flags, err := r.ReadByte()
+		if err != nil {
+			return nil, protocolErr(err)
+		}
+		v := &View{
+			tree:        t,
+			hasLo:       flags&rangeHasLo != 0,
+			loInclusive: flags&rangeLoInclusive != 0,
+			hasHi:       flags&rangeHasHi != 0,
+			hiInclusive: flags&rangeHiInclusive != 0,
+		}
+		if v.hasLo {
+			if v.lo, err = readElem(r, codec); err != nil {
+				return nil, err
+			}
+		}
+		if v.hasHi {
+			if v.hi, err = readElem(r, codec); err != nil {
+				return nil, err
+			}
+		}
+		ranges = append(ranges, v)
+	}
+	return ranges, nil
+}
+
+func putUvarint(b *bytes.Buffer, x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], x)])
+}
+
+func putElem(b *bytes.Buffer, codec Codec, elem interface{}) error {
+	data, err := codec.Marshal(elem)
+	if err != nil {
+		return err
+	}
+	putUvarint(b, uint64(len(data)))
+	b.Write(data)
+	return nil
+}
+
+func readElem(r *bufio.Reader, codec Codec) (interface{}, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, protocolErr(err)
+	}
+	if n > maxFieldSize {
+		return nil, ErrProtocol
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, protocolErr(err)
+	}
+	elem, err := codec.Unmarshal(data)
+	if err != nil {
+		return nil, ErrProtocol
+	}
+	return elem, nil
+}
+
+// protocolErr reports a message cut short as a protocol error, and passes
+// other errors through.
+func protocolErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrProtocol
+	}
+	return err
+}
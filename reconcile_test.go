@@ -0,0 +1,180 @@
+package rbtree
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// divergedTrees returns two trees sharing most of their elements, along with
+// the elements only each holds.
+func divergedTrees(r *rand.Rand, n int) (a, b *RBTree, onlyA, onlyB []interface{}) {
+	a = New(IntComparator, WithHasher(intHasher))
+	b = New(IntComparator, WithHasher(intHasher))
+	for i := 0; i < n; i++ {
+		switch r.Intn(20) {
+		case 0:
+			a.Add(i)
+			onlyA = append(onlyA, i)
+		case 1:
+			b.Add(i)
+			onlyB = append(onlyB, i)
+		case 2, 3:
+		default:
+			a.Add(i)
+			b.Add(i)
+		}
+	}
+	return a, b, onlyA, onlyB
+}
+
+// countingPeer counts the rounds of requests made of a peer.
+type countingPeer struct {
+	peer
+	rounds int
+}
+
+func (p *countingPeer) hashes(ranges []*View) ([]rangeHash, error) {
+	p.rounds++
+	return p.peer.hashes(ranges)
+}
+
+func TestReconcile_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 10, 1000} {
+		a, b, onlyA, onlyB := divergedTrees(r, n)
+		missingA, missingB := Reconcile(a, b)
+		if !reflect.DeepEqual(missingA, onlyB) || !reflect.DeepEqual(missingB, onlyA) {
+			t.Fatalf("Size %v: expected %v and %v. Got %v and %v", n, onlyB, onlyA, missingA, missingB)
+		}
+		missingB, missingA = Reconcile(b, a)
+		if !reflect.DeepEqual(missingA, onlyB) || !reflect.DeepEqual(missingB, onlyA) {
+			t.Fatalf("Size %v, reversed: expected %v and %v. Got %v and %v", n, onlyA, onlyB, missingB, missingA)
+		}
+	}
+}
+
+func TestReconcile_Rounds(t *testing.T) {
+	a := New(IntComparator, WithHasher(intHasher))
+	b := New(IntComparator, WithHasher(intHasher))
+	for i := 0; i < 10000; i++ {
+		a.Add(i)
+		b.Add(9999 - i)
+	}
+	p := &countingPeer{peer: treePeer{b}}
+	if missingA, missingB, _ := reconcile(a, p); missingA != nil || missingB != nil || p.rounds != 1 {
+		t.Fatalf("Expected equal trees to take 1 round. Got %v and %v in %v", missingA, missingB, p.rounds)
+	}
+	b.Remove(1234)
+	p.rounds = 0
+	missingA, missingB, _ := reconcile(a, p)
+	if missingA != nil || !reflect.DeepEqual(missingB, []interface{}{1234}) {
+		t.Fatalf("Expected [1234] missing. Got %v and %v", missingA, missingB)
+	}
+	if p.rounds > 2*30 {
+		t.Fatalf("Expected O(log n) rounds. Got %v", p.rounds)
+	}
+}
+
+func TestReconcile_Versions(t *testing.T) {
+	hasher := func(elem interface{}) uint64 {
+		return uint64(elem.(keyed).key) + uint64(len(elem.(keyed).val))<<32
+	}
+	a := New(keyedComparator, WithHasher(hasher))
+	b := New(keyedComparator, WithHasher(hasher))
+	for i := 0; i < 100; i++ {
+		a.Add(keyed{i, "a"})
+		b.Add(keyed{i, "a"})
+	}
+	a.Add(keyed{42, "new"})
+	missingA, missingB := Reconcile(a, b)
+	if !reflect.DeepEqual(missingA, []interface{}{keyed{42, "a"}}) ||
+		!reflect.DeepEqual(missingB, []interface{}{keyed{42, "new"}}) {
+		t.Fatalf("Expected both versions of 42. Got %v and %v", missingA, missingB)
+	}
+}
+
+func TestReconcile_Remote(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	a, b, onlyA, onlyB := divergedTrees(r, 2000)
+	codec := FixedWidth(IntKeys)
+	client, server := Loopback()
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeReconcile(b, server, codec)
+	}()
+	missingA, missingB, err := ReconcileRemote(a, client, codec)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("Unexpected serving error %v", err)
+	}
+	if !reflect.DeepEqual(missingA, onlyB) || !reflect.DeepEqual(missingB, onlyA) {
+		t.Fatalf("Expected %v and %v. Got %v and %v", onlyB, onlyA, missingA, missingB)
+	}
+}
+
+// readWriter joins a separate reader and writer.
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+func TestReconcile_Protocol(t *testing.T) {
+	codec := FixedWidth(IntKeys)
+	s := New(IntComparator, WithHasher(intHasher))
+	for _, req := range []string{"\x09", "\x01\x01", "\x01\x01\x01\x08abc"} {
+		var out bytes.Buffer
+		if err := ServeReconcile(s, readWriter{bytes.NewBufferString(req), &out}, codec); err != ErrProtocol {
+			t.Fatalf("Request %q: expected %v. Got %v", req, ErrProtocol, err)
+		}
+	}
+	for _, resp := range []string{"", "\x00\x00\x00\x00\x00\x00\x00\x00\x02"} {
+		var out bytes.Buffer
+		_, _, err := ReconcileRemote(s, readWriter{bytes.NewBufferString(resp), &out}, codec)
+		if err != ErrProtocol {
+			t.Fatalf("Response %q: expected %v. Got %v", resp, ErrProtocol, err)
+		}
+	}
+}
+
+func TestReconcile_ZeroHash(t *testing.T) {
+	// intHasher hashes 0 to 0, which must still count.
+	a := New(IntComparator, WithHasher(intHasher))
+	b := New(IntComparator, WithHasher(intHasher))
+	for i := 0; i < 3; i++ {
+		a.Add(i)
+	}
+	b.Add(1)
+	b.Add(2)
+	missingB, missingA := Reconcile(b, a)
+	if !reflect.DeepEqual(missingB, []interface{}{0}) || missingA != nil {
+		t.Fatalf("Expected [0] and []. Got %v and %v", missingB, missingA)
+	}
+}
+
+// stringCodec decodes every payload as a string.
+type stringCodec struct{}
+
+func (stringCodec) Marshal(elem interface{}) ([]byte, error) {
+	return []byte(elem.(string)), nil
+}
+
+func (stringCodec) Unmarshal(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func TestReconcile_ServeWrongType(t *testing.T) {
+	s := New(IntComparator, WithHasher(intHasher))
+	s.Add(1)
+	// A hashes request for the range from "a", which IntComparator can't
+	// compare.
+	req := "\x01\x01\x01\x01a"
+	var out bytes.Buffer
+	if err := ServeReconcile(s, readWriter{bytes.NewBufferString(req), &out}, stringCodec{}); err != ErrProtocol {
+		t.Fatalf("Expected %v. Got %v", ErrProtocol, err)
+	}
+}
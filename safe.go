@@ -0,0 +1,77 @@
+package rbtree
+
+import (
+	"fmt"
+)
+
+// ComparatorPanicError is returned by the Try methods when the tree's
+// comparator panics. Value holds the value passed to panic.
+type ComparatorPanicError struct {
+	Value interface{}
+}
+
+func (e *ComparatorPanicError) Error() string {
+	return fmt.Sprintf("rbtree: comparator panicked: %v", e.Value)
+}
+
+// Unwrap returns Value if it is an error, allowing errors.Is and errors.As
+// to see through to the original panic.
+func (e *ComparatorPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// TryAdd is like Add, but returns an error instead of panicking if the
+// comparator panics. The tree is unchanged when an error is returned.
+func (t *RBTree) TryAdd(elem interface{}) (old interface{}, replaced bool, err error) {
+	defer t.releaseEvents(t.holdEvents())
+	defer recoverComparator(&err)
+	old, replaced = t.Add(elem)
+	return old, replaced, nil
+}
+
+// TryRemove is like Remove, but returns an error instead of panicking if the
+// comparator panics. The tree is unchanged when an error is returned.
+func (t *RBTree) TryRemove(elem interface{}) (removed interface{}, ok bool, err error) {
+	defer t.releaseEvents(t.holdEvents())
+	defer recoverComparator(&err)
+	removed, ok = t.Remove(elem)
+	return removed, ok, nil
+}
+
+// TryContains is like Contains, but returns an error instead of panicking if
+// the comparator panics.
+func (t *RBTree) TryContains(elem interface{}) (found bool, err error) {
+	defer recoverComparator(&err)
+	return t.Contains(elem), nil
+}
+
+// TryGet is like Get, but returns an error instead of panicking if the
+// comparator panics.
+func (t *RBTree) TryGet(probe interface{}) (elem interface{}, found bool, err error) {
+	defer recoverComparator(&err)
+	elem, found = t.Get(probe)
+	return elem, found, nil
+}
+
+// recoverComparator converts a panic into a *ComparatorPanicError stored in
+// *err, passing a *TypeError from checkElem through as is. It must be
+// deferred directly by the Try method.
+//
+// The Try methods are only safe because every mutating method finishes all of
+// its comparator calls before it modifies the tree. Observers' callbacks,
+// which run after, are held back until the recovery is done, so that their
+// panics aren't taken for the comparator's.
+func recoverComparator(err *error) {
+	if r := recover(); r != nil {
+		*err = panicError(r)
+	}
+}
+
+// panicError returns the error reported for the recovered panic value r.
+func panicError(r interface{}) error {
+	if te, ok := r.(*TypeError); ok {
+		return te
+	}
+	return &ComparatorPanicError{Value: r}
+}
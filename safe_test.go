@@ -0,0 +1,137 @@
+package rbtree
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// dumpTree returns a pre-order rendering of the tree's shape and colors so
+// that tests can verify a tree was left structurally untouched.
+func dumpTree(t *RBTree) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "size=%d ", t.size)
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n == nilNode {
+			b.WriteString(".")
+			return
+		}
+		c := "B"
+		if n.color == red {
+			c = "R"
+		}
+		fmt.Fprintf(&b, "(%v%s ", n.elem, c)
+		walk(n.leftChild)
+		b.WriteString(" ")
+		walk(n.rightChild)
+		b.WriteString(")")
+	}
+	walk(t.root)
+	return b.String()
+}
+
+var errInjected = errors.New("injected fault")
+
+// faultyComparator returns an IntComparator that panics with errInjected on
+// its failAt-th call.
+func faultyComparator(failAt int) Comparator {
+	calls := 0
+	return func(a, b interface{}) int {
+		calls++
+		if calls == failAt {
+			panic(errInjected)
+		}
+		return IntComparator(a, b)
+	}
+}
+
+// newFaultyTree builds a tree of elems, then arms a fault on the failAt-th
+// comparator call made after construction.
+func newFaultyTree(elems []int, failAt int) *RBTree {
+	s := New(IntComparator)
+	for _, v := range elems {
+		s.Add(v)
+	}
+	s.cmp = faultyComparator(failAt)
+	return s
+}
+
+func TestTryAdd_FaultInjection(t *testing.T) {
+	elems := []int{50, 20, 80, 10, 30, 70, 90, 5, 15, 25, 35}
+	probes := []int{1, 12, 33, 60, 95, 30}
+	for _, p := range probes {
+		for failAt := 1; ; failAt++ {
+			s := newFaultyTree(elems, failAt)
+			before := dumpTree(s)
+			_, _, err := s.TryAdd(p)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("Expected injected fault. Got %v", err)
+			}
+			if after := dumpTree(s); after != before {
+				t.Fatalf("TryAdd(%v) failing at call %v changed tree.\nBefore: %v\nAfter:  %v",
+					p, failAt, before, after)
+			}
+		}
+	}
+}
+
+func TestTryRemove_FaultInjection(t *testing.T) {
+	elems := []int{50, 20, 80, 10, 30, 70, 90, 5, 15, 25, 35}
+	for _, p := range append(elems, 1, 99) {
+		for failAt := 1; ; failAt++ {
+			s := newFaultyTree(elems, failAt)
+			before := dumpTree(s)
+			_, _, err := s.TryRemove(p)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, errInjected) {
+				t.Fatalf("Expected injected fault. Got %v", err)
+			}
+			if after := dumpTree(s); after != before {
+				t.Fatalf("TryRemove(%v) failing at call %v changed tree.\nBefore: %v\nAfter:  %v",
+					p, failAt, before, after)
+			}
+		}
+	}
+}
+
+func TestTryContains_IncompatibleType(t *testing.T) {
+	s := New(IntComparator)
+	s.Add(1)
+	found, err := s.TryContains("one")
+	if err == nil {
+		t.Fatal("Expected error for incompatible type.")
+	}
+	if found {
+		t.Fatal("Reported found on error.")
+	}
+	var cpe *ComparatorPanicError
+	if !errors.As(err, &cpe) {
+		t.Fatalf("Expected *ComparatorPanicError. Got %T", err)
+	}
+}
+
+func TestTry_NoPanic(t *testing.T) {
+	s := New(IntComparator)
+	if old, replaced, err := s.TryAdd(1); old != nil || replaced || err != nil {
+		t.Fatalf("Unexpected return: %v, %v, %v", old, replaced, err)
+	}
+	if found, err := s.TryContains(1); !found || err != nil {
+		t.Fatalf("Unexpected return: %v, %v", found, err)
+	}
+	if elem, found, err := s.TryGet(1); elem != 1 || !found || err != nil {
+		t.Fatalf("Unexpected return: %v, %v, %v", elem, found, err)
+	}
+	if removed, ok, err := s.TryRemove(1); removed != 1 || !ok || err != nil {
+		t.Fatalf("Unexpected return: %v, %v, %v", removed, ok, err)
+	}
+	if s.Size() != 0 {
+		t.Fatal("Nonzero length.")
+	}
+}
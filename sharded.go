@@ -0,0 +1,320 @@
+package rbtree
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedTree is a sorted set for concurrent use, split by ranges of the
+// comparator's order into shards, each an RBTree with its own lock. Writers
+// to different shards don't contend, while reads and writes to one shard are
+// serialized.
+//
+// Shard boundaries are chosen from the elements themselves. When one shard
+// grows to more than twice the average size, all elements are redistributed
+// evenly across the shards, in O(n) time. Rebalance can also be called
+// directly, e.g. after loading a large batch of elements.
+type ShardedTree struct {
+	cmp  Comparator
+	opts []Option
+	n    int
+
+	// minShardSize is the size below which a shard is never considered
+	// skewed.
+	minShardSize int
+
+	// mu is held for reading by every operation, and for writing while the
+	// shards are rebalanced.
+	mu     sync.RWMutex
+	shards []*shard
+	size   int64
+}
+
+// shard holds the elements from lo, inclusive, up to the next shard's lo.
+// The first shard has no lower bound.
+type shard struct {
+	mu   sync.Mutex
+	tree *RBTree
+	lo   interface{}
+}
+
+const (
+	shardSkew           = 2
+	defaultMinShardSize = 1024
+)
+
+// NewSharded returns an empty ShardedTree which uses the given comparator,
+// and which splits its elements into n shards once there are enough of them.
+// Each shard is created with New(cmp, opts...). It panics if opts include
+// WithCapacity, which would limit each shard rather than the whole tree.
+func NewSharded(cmp Comparator, n int, opts ...Option) *ShardedTree {
+	if n < 1 {
+		n = 1
+	}
+	first := New(cmp, opts...)
+	if first.capacity != 0 {
+		panic("rbtree: ShardedTree doesn't support WithCapacity")
+	}
+	return &ShardedTree{
+		cmp:          cmp,
+		opts:         opts,
+		n:            n,
+		minShardSize: defaultMinShardSize,
+		shards:       []*shard{{tree: first}},
+	}
+}
+
+// shardFor returns the shard whose range holds elem. s.mu must be held.
+func (s *ShardedTree) shardFor(elem interface{}) int {
+	// The first shard after the one holding elem is the first whose lower
+	// bound is greater than elem.
+	return sort.Search(len(s.shards)-1, func(i int) bool {
+		return s.cmp(s.shards[i+1].lo, elem) > 0
+	})
+}
+
+// Add adds an element, as RBTree.Add does.
+func (s *ShardedTree) Add(elem interface{}) (old interface{}, replaced bool) {
+	s.mu.RLock()
+	sh := s.shards[s.shardFor(elem)]
+	sh.mu.Lock()
+	old, replaced = sh.tree.Add(elem)
+	size := sh.tree.size
+	sh.mu.Unlock()
+	if !replaced {
+		atomic.AddInt64(&s.size, 1)
+	}
+	skewed := s.skewed(size, len(s.shards))
+	s.mu.RUnlock()
+	if skewed {
+		s.rebalanceIfSkewed()
+	}
+	return old, replaced
+}
+
+// Remove removes the element equal to elem, as RBTree.Remove does.
+func (s *ShardedTree) Remove(elem interface{}) (removed interface{}, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sh := s.shards[s.shardFor(elem)]
+	sh.mu.Lock()
+	removed, ok = sh.tree.Remove(elem)
+	sh.mu.Unlock()
+	if ok {
+		atomic.AddInt64(&s.size, -1)
+	}
+	return removed, ok
+}
+
+// Contains returns whether elem exists in the tree.
+func (s *ShardedTree) Contains(elem interface{}) bool {
+	_, found := s.Get(elem)
+	return found
+}
+
+// Get returns the element equal to probe, or (nil, false) if none exists.
+func (s *ShardedTree) Get(probe interface{}) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sh := s.shards[s.shardFor(probe)]
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.tree.Get(probe)
+}
+
+// First returns the smallest element or (nil, false) if the tree is empty.
+func (s *ShardedTree) First() (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		first, ok := sh.tree.First()
+		sh.mu.Unlock()
+		if ok {
+			return first, true
+		}
+	}
+	return nil, false
+}
+
+// Last returns the largest element or (nil, false) if the tree is empty.
+func (s *ShardedTree) Last() (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.shards) - 1; i >= 0; i-- {
+		sh := s.shards[i]
+		sh.mu.Lock()
+		last, ok := sh.tree.Last()
+		sh.mu.Unlock()
+		if ok {
+			return last, true
+		}
+	}
+	return nil, false
+}
+
+// Size returns the number of elements in the tree, across all shards.
+func (s *ShardedTree) Size() int {
+	return int(atomic.LoadInt64(&s.size))
+}
+
+// IsEmpty returns whether the tree is empty.
+func (s *ShardedTree) IsEmpty() bool {
+	return s.Size() == 0
+}
+
+// Shards returns the number of shards the elements are currently split into.
+func (s *ShardedTree) Shards() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.shards)
+}
+
+// ForEach iterates over the tree's elements in sorted order, calling f on
+// each. No locks are held while f runs, so f may change the tree. See
+// ShardedIterator for what the iteration sees of concurrent changes.
+func (s *ShardedTree) ForEach(f func(interface{})) {
+	it := s.Iterator()
+	for it.Next() {
+		f(it.Value())
+	}
+}
+
+// ToSlice returns the tree's elements in a sorted slice.
+func (s *ShardedTree) ToSlice() (elems []interface{}) {
+	s.ForEach(func(a interface{}) {
+		elems = append(elems, a)
+	})
+	return
+}
+
+// Rebalance redistributes the elements evenly across the shards, choosing
+// new boundaries between them. It takes O(n) time, during which all other
+// operations wait.
+func (s *ShardedTree) Rebalance() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rebalance()
+}
+
+func (s *ShardedTree) rebalanceIfSkewed() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Another writer may have rebalanced already.
+	for _, sh := range s.shards {
+		if s.skewed(sh.tree.size, len(s.shards)) {
+			s.rebalance()
+			return
+		}
+	}
+}
+
+// skewed returns whether a shard of the given size is so much larger than
+// the average that the shards should be rebalanced.
+func (s *ShardedTree) skewed(shardSize int, shards int) bool {
+	if shardSize < s.minShardSize {
+		return false
+	}
+	if shards < s.n {
+		return true
+	}
+	return shardSize > shardSkew*s.Size()/shards
+}
+
+// rebalance must be called with s.mu held for writing.
+func (s *ShardedTree) rebalance() {
+	elems := make([]interface{}, 0, s.Size())
+	for _, sh := range s.shards {
+		forEachNode(sh.tree.root, func(n *node) {
+			elems = append(elems, n.elem)
+		})
+	}
+	n := s.n
+	if n > len(elems) {
+		n = len(elems)
+	}
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		chunk := elems[i*len(elems)/n : (i+1)*len(elems)/n]
+		sh := &shard{tree: New(s.cmp, s.opts...)}
+		sh.tree.buildFrom(chunk)
+		if i > 0 {
+			sh.lo = chunk[0]
+		}
+		shards[i] = sh
+	}
+	s.shards = shards
+}
+
+// ShardedIterator steps through a ShardedTree's elements in order. It copies
+// elements out of the tree in small batches, holding a shard's lock only
+// while copying from it, so the tree may change during iteration. Each
+// element returned is greater than the last, and was in the tree when its
+// batch was copied.
+type ShardedIterator struct {
+	tree    *ShardedTree
+	batch   []interface{}
+	pos     int
+	curr    interface{}
+	started bool
+	done    bool
+}
+
+const shardedBatchSize = 64
+
+// Iterator returns an iterator over the tree's elements in sorted order.
+func (s *ShardedTree) Iterator() *ShardedIterator {
+	return &ShardedIterator{tree: s}
+}
+
+// Next advances the iterator, returning false once no elements remain.
+func (it *ShardedIterator) Next() bool {
+	if it.pos == len(it.batch) {
+		if it.done {
+			return false
+		}
+		it.fill()
+		if len(it.batch) == 0 {
+			it.done = true
+			it.curr = nil
+			return false
+		}
+	}
+	it.curr = it.batch[it.pos]
+	it.pos++
+	it.started = true
+	return true
+}
+
+// Value returns the current element, or nil if Next has not returned true.
+func (it *ShardedIterator) Value() interface{} {
+	return it.curr
+}
+
+// fill copies the next batch of elements, those following the current one.
+func (it *ShardedIterator) fill() {
+	s := it.tree
+	it.batch, it.pos = it.batch[:0], 0
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := 0
+	if it.started {
+		i = s.shardFor(it.curr)
+	}
+	for ; i < len(s.shards) && len(it.batch) == 0; i++ {
+		sh := s.shards[i]
+		sh.mu.Lock()
+		n := sh.tree.min
+		if it.started {
+			n = sh.tree.ceilingNode(it.curr, false)
+		}
+		for ; n != nilNode && len(it.batch) < shardedBatchSize; n = nextNode(n) {
+			it.batch = append(it.batch, n.elem)
+		}
+		sh.mu.Unlock()
+	}
+}
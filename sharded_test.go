@@ -0,0 +1,194 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// checkShards verifies that each shard is a valid tree whose elements lie
+// within its bounds, and that the shard sizes add up.
+func checkShards(t *testing.T, s *ShardedTree) {
+	total := 0
+	for i, sh := range s.shards {
+		checkInvariants(t, sh.tree)
+		total += sh.tree.Size()
+		sh.tree.ForEach(func(elem interface{}) {
+			if i > 0 && s.cmp(elem, sh.lo) < 0 ||
+				i+1 < len(s.shards) && s.cmp(elem, s.shards[i+1].lo) >= 0 {
+				t.Fatalf("Element %v is outside shard %v's range.", elem, i)
+			}
+		})
+	}
+	if total != s.Size() {
+		t.Fatalf("Expected size %v. Got %v", total, s.Size())
+	}
+}
+
+func TestSharded_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := NewSharded(IntComparator, 8)
+	s.minShardSize = 16
+	model := New(IntComparator)
+	for i := 0; i < 20000; i++ {
+		// Skew additions towards ever larger values to force rebalancing.
+		x := r.Intn(1000) + i/4
+		if r.Intn(3) == 0 {
+			_, ok := s.Remove(x)
+			if _, want := model.Remove(x); ok != want {
+				t.Fatalf("Remove(%v) returned %v.", x, ok)
+			}
+		} else {
+			_, replaced := s.Add(x)
+			if _, want := model.Add(x); replaced != want {
+				t.Fatalf("Add(%v) returned replaced = %v.", x, replaced)
+			}
+		}
+		if i%1000 == 0 {
+			checkShards(t, s)
+		}
+	}
+	checkShards(t, s)
+	if s.Shards() != 8 {
+		t.Fatalf("Expected 8 shards. Got %v", s.Shards())
+	}
+	if !reflect.DeepEqual(s.ToSlice(), model.ToSlice()) {
+		t.Fatal("ToSlice returned wrong elements.")
+	}
+	first, _ := model.First()
+	last, _ := model.Last()
+	if got, _ := s.First(); got != first {
+		t.Fatalf("Expected %v. Got %v", first, got)
+	}
+	if got, _ := s.Last(); got != last {
+		t.Fatalf("Expected %v. Got %v", last, got)
+	}
+}
+
+func TestSharded_Rebalance(t *testing.T) {
+	s := NewSharded(IntComparator, 4)
+	for i := 0; i < 100; i++ {
+		s.Add(i)
+	}
+	if s.Shards() != 1 {
+		t.Fatalf("Expected 1 shard below the minimum shard size. Got %v", s.Shards())
+	}
+	s.Rebalance()
+	checkShards(t, s)
+	for i, sh := range s.shards {
+		if sh.tree.Size() != 25 {
+			t.Fatalf("Expected shard %v to hold 25 elements. Got %v", i, sh.tree.Size())
+		}
+	}
+	if !reflect.DeepEqual(s.ToSlice(), ints(0, 100, 1)) {
+		t.Fatalf("Expected %v. Got %v", ints(0, 100, 1), s.ToSlice())
+	}
+}
+
+func TestSharded_IteratorSeesChanges(t *testing.T) {
+	s := NewSharded(IntComparator, 4)
+	for i := 0; i < 1000; i++ {
+		s.Add(i)
+	}
+	s.Rebalance()
+	var got []interface{}
+	s.ForEach(func(elem interface{}) {
+		got = append(got, elem)
+		if elem == 100 {
+			// Removals and rebalancing behind and ahead of the iterator.
+			for i := 0; i < 1000; i += 2 {
+				s.Remove(i)
+			}
+			s.Rebalance()
+		}
+	})
+	// Elements already copied in the current batch are still returned.
+	batchEnd := 2 * shardedBatchSize
+	want := append(ints(0, batchEnd, 1), ints(batchEnd+1, 1001, 2)...)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v. Got %v", want, got)
+	}
+}
+
+func TestSharded_Concurrent(t *testing.T) {
+	s := NewSharded(IntComparator, 8)
+	s.minShardSize = 64
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(base int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				s.Add(base + j)
+				if j%2 == 1 {
+					s.Remove(base + j - 1)
+				}
+			}
+		}(w * 10000)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 20; k++ {
+				prev := -1
+				s.ForEach(func(elem interface{}) {
+					if elem.(int) <= prev {
+						t.Errorf("Element %v follows %v.", elem, prev)
+					}
+					prev = elem.(int)
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	checkShards(t, s)
+	if s.Size() != 8000 {
+		t.Fatalf("Expected size 8000. Got %v", s.Size())
+	}
+}
+
+// mutexTree is an RBTree behind a single lock, for comparison.
+type mutexTree struct {
+	mu   sync.Mutex
+	tree *RBTree
+}
+
+func (m *mutexTree) Add(elem interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tree.Add(elem)
+}
+
+func benchmarkParallelAdd(b *testing.B, add func(interface{})) {
+	for i := 0; i < startingSize; i++ {
+		add(rand.Intn(startingSize * 4))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		r := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			add(r.Intn(startingSize * 4))
+		}
+	})
+}
+
+func BenchmarkAdd_Parallel_Sharded(b *testing.B) {
+	s := NewSharded(IntComparator, 16)
+	benchmarkParallelAdd(b, func(elem interface{}) { s.Add(elem) })
+}
+
+func BenchmarkAdd_Parallel_Mutex(b *testing.B) {
+	m := &mutexTree{tree: New(IntComparator)}
+	benchmarkParallelAdd(b, m.Add)
+}
+
+func TestSharded_Capacity(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected NewSharded to panic with WithCapacity.")
+		}
+	}()
+	NewSharded(IntComparator, 4, WithCapacity(2, RejectNew))
+}
@@ -0,0 +1,262 @@
+package rbtree
+
+import (
+	"errors"
+)
+
+// ErrTxnDone is returned by Commit, and used to panic by the other methods of
+// a Txn, once the transaction has been committed or rolled back.
+var ErrTxnDone = errors.New("rbtree: transaction already committed or rolled back")
+
+// Txn is a set of changes to an RBTree that are made together by Commit or
+// discarded by Rollback. Changes are buffered in the Txn rather than made to
+// the tree, so until Commit the tree is untouched, and Rollback leaves it
+// exactly as it was. The Txn's own reads see its buffered changes.
+//
+// Commit fails with ErrModified if the tree has had elements added or
+// removed since Begin, other than by replacement.
+type Txn struct {
+	tree *RBTree
+
+	// pending holds a *txnOp for each element changed by the Txn, ordered by
+	// the tree's comparator.
+	pending  *RBTree
+	size     int
+	modCount int
+	done     bool
+}
+
+// txnOp records the last change made by a Txn to the elements equal to elem.
+type txnOp struct {
+	elem   interface{}
+	remove bool
+}
+
+// Begin starts a transaction on the tree. It panics if the tree has a
+// capacity, since the Txn couldn't tell which of its changes would be
+// rejected or evict other elements until Commit.
+func (t *RBTree) Begin() *Txn {
+	if t.capacity != 0 {
+		panic("rbtree: Txn doesn't support trees with a capacity; see WithCapacity")
+	}
+	tx := &Txn{
+		tree:     t,
+		size:     t.size,
+		modCount: t.modCount,
+	}
+	tx.pending = New(func(a, b interface{}) int {
+		return tx.tree.cmp(opElem(a), opElem(b))
+	})
+	return tx
+}
+
+// opElem unwraps a *txnOp, leaving probes passed to the pending tree as is.
+func opElem(a interface{}) interface{} {
+	if op, ok := a.(*txnOp); ok {
+		return op.elem
+	}
+	return a
+}
+
+// Add buffers the addition of elem, returning the element it will replace as
+// RBTree.Add does.
+func (tx *Txn) Add(elem interface{}) (old interface{}, replaced bool) {
+	tx.check()
+	if tx.tree.typed {
+		tx.tree.checkElem(elem)
+	}
+	old, replaced = tx.get(elem)
+	tx.pending.Add(&txnOp{elem: elem})
+	if !replaced {
+		tx.size++
+	}
+	return old, replaced
+}
+
+// Remove buffers the removal of elem, returning the element it will remove as
+// RBTree.Remove does.
+func (tx *Txn) Remove(elem interface{}) (removed interface{}, ok bool) {
+	tx.check()
+	if tx.tree.typed {
+		tx.tree.checkElem(elem)
+	}
+	removed, ok = tx.get(elem)
+	if !ok {
+		return nil, false
+	}
+	tx.pending.Add(&txnOp{elem: elem, remove: true})
+	tx.size--
+	return removed, true
+}
+
+// Contains returns whether elem exists in the tree as the Txn would leave it.
+func (tx *Txn) Contains(elem interface{}) bool {
+	_, found := tx.Get(elem)
+	return found
+}
+
+// Get returns the element equal to probe in the tree as the Txn would leave
+// it, or (nil, false) if none exists.
+func (tx *Txn) Get(probe interface{}) (interface{}, bool) {
+	tx.check()
+	if tx.tree.typed {
+		tx.tree.checkElem(probe)
+	}
+	return tx.get(probe)
+}
+
+func (tx *Txn) get(probe interface{}) (interface{}, bool) {
+	if n := tx.pending.getNode(probe); n != nil {
+		op := n.elem.(*txnOp)
+		if op.remove {
+			return nil, false
+		}
+		return op.elem, true
+	}
+	return tx.tree.Get(probe)
+}
+
+// Size returns the number of elements in the tree as the Txn would leave it.
+func (tx *Txn) Size() int {
+	tx.check()
+	return tx.size
+}
+
+// IsEmpty returns whether the tree would be empty after the Txn.
+func (tx *Txn) IsEmpty() bool {
+	return tx.Size() == 0
+}
+
+// ForEach iterates in sorted order over the elements of the tree as the Txn
+// would leave it, calling f on each. Like RBTree.ForEach, it panics with
+// ErrModified if the tree is modified by f.
+func (tx *Txn) ForEach(f func(interface{})) {
+	tx.check()
+	t := tx.tree
+	modCount := t.modCount
+	base, p := t.min, tx.pending.min
+	for base != nilNode || p != nilNode {
+		var cmp int
+		switch {
+		case p == nilNode:
+			cmp = -1
+		case base == nilNode:
+			cmp = 1
+		default:
+			cmp = t.cmp(base.elem, p.elem.(*txnOp).elem)
+		}
+		if cmp < 0 {
+			f(base.elem)
+			base = nextNode(base)
+		} else {
+			if op := p.elem.(*txnOp); !op.remove {
+				f(op.elem)
+			}
+			if cmp == 0 {
+				base = nextNode(base)
+			}
+			p = nextNode(p)
+		}
+		if t.modCount != modCount {
+			panic(ErrModified)
+		}
+	}
+}
+
+// ToSlice returns the elements of the tree as the Txn would leave it, in a
+// sorted slice.
+func (tx *Txn) ToSlice() (s []interface{}) {
+	tx.ForEach(func(a interface{}) {
+		s = append(s, a)
+	})
+	return
+}
+
+// Commit makes the Txn's changes to the tree. If the tree has been modified
+// since Begin, it returns ErrModified and leaves the tree unchanged. Every
+// comparison is made before the tree is touched, so if the comparator panics,
+// a *ComparatorPanicError is returned and the tree is left exactly as it was.
+//
+// The Txn can't be used after Commit, whether or not it succeeds.
+func (tx *Txn) Commit() error {
+	if tx.done {
+		return ErrTxnDone
+	}
+	tx.done = true
+	t := tx.tree
+	if t.modCount != tx.modCount {
+		return ErrModified
+	}
+	steps, err := tx.plan()
+	if err != nil {
+		return err
+	}
+	for _, s := range steps {
+		switch {
+		case s.op.remove:
+			if s.n != nilNode {
+				t.removeNode(s.n)
+			}
+		case s.n != nilNode:
+			t.replaceElem(s.n, s.op.elem)
+		default:
+			t.linkBefore(t.newNode(s.op.elem), s.next)
+		}
+	}
+	return nil
+}
+
+// txnStep is a change planned by Commit. n is the tree's node equal to op's
+// element, or nilNode if there is none, in which case next is the node of the
+// least greater element, or nilNode if there is none.
+type txnStep struct {
+	op      *txnOp
+	n, next *node
+}
+
+// plan locates each of the Txn's changes in the tree, without changing it.
+// Steps are in sorted order, so each step's nodes are still in the tree when
+// it is applied: earlier steps only remove lesser elements.
+func (tx *Txn) plan() (steps []txnStep, err error) {
+	defer recoverComparator(&err)
+	t := tx.tree
+	for p := tx.pending.min; p != nilNode; p = nextNode(p) {
+		op := p.elem.(*txnOp)
+		n, parent, cmp := t.search(op.elem)
+		next := nilNode
+		if n == nilNode && parent != nilNode {
+			next = parent
+			if cmp > 0 {
+				next = nextNode(parent)
+			}
+		}
+		steps = append(steps, txnStep{op, n, next})
+	}
+	return steps, nil
+}
+
+// linkBefore links n in just before next, or after the greatest element if
+// next is nilNode, without calling the comparator.
+func (t *RBTree) linkBefore(n *node, next *node) {
+	switch {
+	case next == nilNode:
+		t.linkAt(n, t.max, 1)
+	case next.leftChild == nilNode:
+		t.linkAt(n, next, -1)
+	default:
+		t.linkAt(n, maxNode(next.leftChild), 1)
+	}
+}
+
+// Rollback discards the Txn's changes. The tree is left exactly as it was.
+// Rollback does nothing if the Txn has already been committed or rolled back.
+func (tx *Txn) Rollback() {
+	tx.done = true
+	tx.pending = nil
+}
+
+func (tx *Txn) check() {
+	if tx.done {
+		panic(ErrTxnDone)
+	}
+}
@@ -0,0 +1,163 @@
+package rbtree
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTxn_ReadsOwnWrites(t *testing.T) {
+	s := newRangeTree(0, 10)
+	tx := s.Begin()
+	tx.Add(20)
+	tx.Remove(5)
+	tx.Remove(100)
+	if !tx.Contains(20) || tx.Contains(5) || !tx.Contains(4) {
+		t.Fatal("Txn doesn't see its own writes.")
+	}
+	if s.Contains(20) || !s.Contains(5) {
+		t.Fatal("Txn changed the tree before Commit.")
+	}
+	if tx.Size() != 10 {
+		t.Fatalf("Expected size 10. Got %v", tx.Size())
+	}
+	want := []interface{}{0, 1, 2, 3, 4, 6, 7, 8, 9, 20}
+	if !reflect.DeepEqual(tx.ToSlice(), want) {
+		t.Fatalf("Expected %v. Got %v", want, tx.ToSlice())
+	}
+	if old, replaced := tx.Add(5); replaced || old != nil {
+		t.Fatalf("Expected no replacement of removed element. Got %v", old)
+	}
+	if removed, ok := tx.Remove(20); !ok || removed != 20 {
+		t.Fatalf("Expected to remove 20. Got %v, %v", removed, ok)
+	}
+}
+
+func TestTxn_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 50; round++ {
+		s := New(IntComparator)
+		for i := 0; i < 100; i++ {
+			s.Add(r.Intn(200))
+		}
+		before := dumpTree(s)
+		want := map[int]bool{}
+		s.ForEach(func(elem interface{}) {
+			want[elem.(int)] = true
+		})
+		tx := s.Begin()
+		for i := 0; i < 100; i++ {
+			v := r.Intn(200)
+			if r.Intn(2) == 0 {
+				if _, replaced := tx.Add(v); replaced != want[v] {
+					t.Fatalf("Add(%v) returned replaced = %v.", v, replaced)
+				}
+				want[v] = true
+			} else {
+				if _, ok := tx.Remove(v); ok != want[v] {
+					t.Fatalf("Remove(%v) returned ok = %v.", v, ok)
+				}
+				delete(want, v)
+			}
+			if tx.Size() != len(want) {
+				t.Fatalf("Expected size %v. Got %v", len(want), tx.Size())
+			}
+		}
+		var sorted []interface{}
+		for v := range want {
+			sorted = append(sorted, v)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].(int) < sorted[j].(int) })
+		if !reflect.DeepEqual(tx.ToSlice(), sorted) {
+			t.Fatalf("Expected %v. Got %v", sorted, tx.ToSlice())
+		}
+		if dumpTree(s) != before {
+			t.Fatal("Txn changed the tree before Commit.")
+		}
+		if round%2 == 0 {
+			tx.Rollback()
+			if dumpTree(s) != before {
+				t.Fatal("Rollback didn't restore the tree's exact structure.")
+			}
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		checkInvariants(t, s)
+		if !reflect.DeepEqual(s.ToSlice(), sorted) {
+			t.Fatalf("Expected %v. Got %v", sorted, s.ToSlice())
+		}
+	}
+}
+
+func TestTxn_CommitAfterModification(t *testing.T) {
+	s := newRangeTree(0, 10)
+	tx := s.Begin()
+	tx.Add(10)
+	s.Remove(0)
+	if err := tx.Commit(); err != ErrModified {
+		t.Fatalf("Expected %v. Got %v", ErrModified, err)
+	}
+	if s.Contains(10) {
+		t.Fatal("Failed Commit changed the tree.")
+	}
+}
+
+func TestTxn_CommitComparatorPanic(t *testing.T) {
+	for failAt := 1; failAt < 400; failAt++ {
+		s := newRangeTree(0, 100)
+		before := dumpTree(s)
+		tx := s.Begin()
+		for i := 0; i < 100; i += 5 {
+			tx.Remove(i)
+			tx.Add(i + 1000)
+		}
+		s.cmp = faultyComparator(failAt)
+		err := tx.Commit()
+		s.cmp = IntComparator
+		checkInvariants(t, s)
+		if err == nil {
+			if s.Size() != 100 || s.Contains(0) || !s.Contains(1000) {
+				t.Fatal("Commit didn't apply the Txn's changes.")
+			}
+			continue
+		}
+		if !errors.Is(err, errInjected) {
+			t.Fatalf("Expected %v. Got %v", errInjected, err)
+		}
+		if got := dumpTree(s); got != before {
+			t.Fatalf("failAt %v: failed Commit changed the tree. Expected %v. Got %v", failAt, before, got)
+		}
+	}
+}
+
+func TestTxn_Done(t *testing.T) {
+	s := New(IntComparator)
+	tx := s.Begin()
+	tx.Add(1)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := tx.Commit(); err != ErrTxnDone {
+		t.Fatalf("Expected %v. Got %v", ErrTxnDone, err)
+	}
+	defer func() {
+		if r := recover(); r != ErrTxnDone {
+			t.Fatalf("Expected panic with %v. Got %v", ErrTxnDone, r)
+		}
+	}()
+	tx.Add(2)
+}
+
+func TestTxn_Capacity(t *testing.T) {
+	s := New(IntComparator, WithCapacity(2, EvictMin))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected Begin to panic on a tree with a capacity.")
+		}
+	}()
+	s.Begin()
+}
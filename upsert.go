@@ -0,0 +1,118 @@
+package rbtree
+
+// The methods in this file combine a lookup with a mutation so that each
+// needs only a single descent from the root, rather than a Contains followed
+// by a Remove and an Add.
+//
+// Where a method takes a function, the function is called before the tree is
+// modified, so a panic inside it leaves the tree unchanged. Any element the
+// function returns in place of an existing one must compare equal to it; a
+// panic is raised otherwise, as the element would be out of order.
+
+// GetOrAdd returns the stored element equal to elem and true if one exists.
+// Otherwise it adds elem and returns it with loaded set to false, or returns
+// nil and false if the tree is full and elem was rejected.
+func (t *RBTree) GetOrAdd(elem interface{}) (actual interface{}, loaded bool) {
+	n, loaded := t.getOrAdd(elem)
+	if n == nilNode {
+		return nil, false
+	}
+	return n.elem, loaded
+}
+
+// AddIfAbsent adds elem if no equal element exists, returning whether it was
+// added. Unlike Add, it never replaces an existing element.
+func (t *RBTree) AddIfAbsent(elem interface{}) bool {
+	n, loaded := t.getOrAdd(elem)
+	return n != nilNode && !loaded
+}
+
+// getOrAdd is GetOrAdd returning the element's node, or nilNode if it was
+// rejected.
+func (t *RBTree) getOrAdd(elem interface{}) (n *node, loaded bool) {
+	if t.typed {
+		t.checkElem(elem)
+	}
+	n, parent, cmp := t.search(elem)
+	if n != nilNode {
+		return n, true
+	}
+	victim, ok := t.admit(parent, cmp)
+	if !ok {
+		return nilNode, false
+	}
+	return t.insertEvicting(elem, parent, cmp, victim), false
+}
+
+// Update replaces the stored element equal to probe with f(old), returning
+// true, or returns false without calling f if no such element exists.
+func (t *RBTree) Update(probe interface{}, f func(old interface{}) interface{}) bool {
+	if t.typed {
+		t.checkElem(probe)
+	}
+	n, _, _ := t.search(probe)
+	if n == nilNode {
+		return false
+	}
+	elem := f(n.elem)
+	if t.typed {
+		t.checkElem(elem)
+	}
+	t.mustEqual(elem, n.elem)
+	t.replaceElem(n, elem)
+	return true
+}
+
+// Compute calls f with the stored element equal to probe, or with nil and
+// false if none exists, and applies its result in a single pass:
+//
+//	exists  keep   outcome
+//	true    true   the stored element is replaced with elem
+//	true    false  the stored element is removed
+//	false   true   elem is added
+//	false   false  the tree is unchanged
+//
+// It returns the element stored afterwards and whether one is present. If
+// the tree is full and elem is rejected, the tree is unchanged.
+func (t *RBTree) Compute(probe interface{}, f func(old interface{}, exists bool) (elem interface{}, keep bool)) (interface{}, bool) {
+	if t.typed {
+		t.checkElem(probe)
+	}
+	n, parent, cmp := t.search(probe)
+	exists := n != nilNode
+	var old interface{}
+	if exists {
+		old = n.elem
+	}
+
+	elem, keep := f(old, exists)
+	if keep {
+		if t.typed {
+			t.checkElem(elem)
+		}
+		t.mustEqual(elem, probe)
+	}
+
+	switch {
+	case exists && keep:
+		t.replaceElem(n, elem)
+	case exists:
+		t.removeNode(n)
+	case keep:
+		victim, ok := t.admit(parent, cmp)
+		if !ok {
+			return nil, false
+		}
+		t.insertEvicting(elem, parent, cmp, victim)
+	}
+	if !keep {
+		return nil, false
+	}
+	return elem, true
+}
+
+func (t *RBTree) mustEqual(elem, existing interface{}) {
+	if t.cmp(elem, existing) != 0 {
+		panic("rbtree: function returned an element not equal to the original")
+	}
+}
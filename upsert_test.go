@@ -0,0 +1,138 @@
+package rbtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestGetOrAdd(t *testing.T) {
+	s := New(keyedComparator)
+	actual, loaded := s.GetOrAdd(keyed{1, "a"})
+	if loaded || actual != (keyed{1, "a"}) {
+		t.Fatalf("Expected ({1 a}, false). Got (%v, %v)", actual, loaded)
+	}
+	actual, loaded = s.GetOrAdd(keyed{1, "b"})
+	if !loaded || actual != (keyed{1, "a"}) {
+		t.Fatalf("Expected ({1 a}, true). Got (%v, %v)", actual, loaded)
+	}
+	if s.Size() != 1 {
+		t.Fatalf("Expected size 1. Got %v", s.Size())
+	}
+}
+
+func TestAddIfAbsent(t *testing.T) {
+	s := New(keyedComparator)
+	if !s.AddIfAbsent(keyed{1, "a"}) {
+		t.Fatal("Failed to add to empty set.")
+	}
+	if s.AddIfAbsent(keyed{1, "b"}) {
+		t.Fatal("Added duplicate element.")
+	}
+	if got, _ := s.Get(keyed{key: 1}); got != (keyed{1, "a"}) {
+		t.Fatalf("Existing element was replaced with %v", got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := New(keyedComparator)
+	called := false
+	if s.Update(keyed{key: 1}, func(interface{}) interface{} { called = true; return nil }) {
+		t.Fatal("Updated missing element.")
+	}
+	if called {
+		t.Fatal("Called update function for missing element.")
+	}
+
+	s.Add(keyed{1, "a"})
+	ok := s.Update(keyed{key: 1}, func(old interface{}) interface{} {
+		k := old.(keyed)
+		k.val += "b"
+		return k
+	})
+	if !ok {
+		t.Fatal("Failed to update element.")
+	}
+	if got, _ := s.Get(keyed{key: 1}); got != (keyed{1, "ab"}) {
+		t.Fatalf("Expected {1 ab}. Got %v", got)
+	}
+}
+
+func TestUpdate_KeyChangePanics(t *testing.T) {
+	s := New(keyedComparator)
+	s.Add(keyed{1, "a"})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected panic.")
+		}
+		if got, _ := s.Get(keyed{key: 1}); got != (keyed{1, "a"}) {
+			t.Fatalf("Element changed to %v", got)
+		}
+	}()
+	s.Update(keyed{key: 1}, func(interface{}) interface{} { return keyed{2, "a"} })
+}
+
+func TestCompute_Outcomes(t *testing.T) {
+	s := New(keyedComparator)
+
+	// Absent, not kept.
+	if elem, ok := s.Compute(keyed{key: 1}, func(old interface{}, exists bool) (interface{}, bool) {
+		if exists || old != nil {
+			t.Fatalf("Unexpected arguments: %v, %v", old, exists)
+		}
+		return nil, false
+	}); ok || elem != nil || s.Size() != 0 {
+		t.Fatalf("Expected no change. Got (%v, %v), size %v", elem, ok, s.Size())
+	}
+
+	// Absent, kept: insert.
+	if elem, ok := s.Compute(keyed{key: 1}, func(interface{}, bool) (interface{}, bool) {
+		return keyed{1, "a"}, true
+	}); !ok || elem != (keyed{1, "a"}) || s.Size() != 1 {
+		t.Fatalf("Expected insert. Got (%v, %v), size %v", elem, ok, s.Size())
+	}
+
+	// Present, kept: replace.
+	if elem, ok := s.Compute(keyed{key: 1}, func(old interface{}, exists bool) (interface{}, bool) {
+		if !exists || old != (keyed{1, "a"}) {
+			t.Fatalf("Unexpected arguments: %v, %v", old, exists)
+		}
+		return keyed{1, "b"}, true
+	}); !ok || elem != (keyed{1, "b"}) || s.Size() != 1 {
+		t.Fatalf("Expected replace. Got (%v, %v), size %v", elem, ok, s.Size())
+	}
+
+	// Present, not kept: delete.
+	if elem, ok := s.Compute(keyed{key: 1}, func(interface{}, bool) (interface{}, bool) {
+		return nil, false
+	}); ok || elem != nil || s.Size() != 0 {
+		t.Fatalf("Expected delete. Got (%v, %v), size %v", elem, ok, s.Size())
+	}
+	if s.Contains(keyed{key: 1}) {
+		t.Fatal("Deleted element still present.")
+	}
+}
+
+func TestCompute_Random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	s := New(IntComparator)
+	want := map[int]bool{}
+	for i := 0; i < 5000; i++ {
+		v := r.Intn(300)
+		keep := r.Intn(2) == 0
+		s.Compute(v, func(old interface{}, exists bool) (interface{}, bool) {
+			if exists != want[v] {
+				t.Fatalf("Compute(%v) reported exists=%v", v, exists)
+			}
+			return v, keep
+		})
+		if keep {
+			want[v] = true
+		} else {
+			delete(want, v)
+		}
+		if s.Size() != len(want) {
+			t.Fatalf("Expected size %v. Got %v", len(want), s.Size())
+		}
+	}
+	checkInvariants(t, s)
+}
@@ -0,0 +1,283 @@
+package rbtree
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ErrVersionUnavailable is returned by AsOf for a version that doesn't exist
+// yet or has been released.
+var ErrVersionUnavailable = errors.New("rbtree: version not available")
+
+// VersionedTree is a sorted set that keeps its past versions. Each commit of
+// changes produces a new version, numbered one more than the last, and the
+// set as of any version that hasn't been released can be read with AsOf.
+//
+// Versions are persistent trees which share every node that a commit didn't
+// change, so a commit of a single change costs O(log n) time and space.
+// Nodes which no retained version or outstanding Snapshot can reach are
+// reclaimed by the garbage collector.
+//
+// A VersionedTree is safe for concurrent use. Commits are serialized, while
+// reads of a Snapshot need no locking at all.
+type VersionedTree struct {
+	cmp Comparator
+
+	mu       sync.Mutex
+	current  *Snapshot
+	retained map[uint64]*Snapshot
+}
+
+// Snapshot is the immutable contents of a VersionedTree as of one version.
+type Snapshot struct {
+	cmp     Comparator
+	root    *pnode
+	size    int
+	version uint64
+}
+
+// NewVersioned returns an empty VersionedTree which uses the given
+// comparator. Its first version, 0, is empty.
+func NewVersioned(cmp Comparator) *VersionedTree {
+	s := &Snapshot{cmp: cmp}
+	return &VersionedTree{
+		cmp:      cmp,
+		current:  s,
+		retained: map[uint64]*Snapshot{0: s},
+	}
+}
+
+// VersionWriter makes changes for VersionedTree.Update and AtomicTree.Update.
+// Its reads see the changes it has made.
+type VersionWriter struct {
+	Snapshot
+	changed bool
+}
+
+// Add adds elem, returning the element it replaced as RBTree.Add does.
+func (w *VersionWriter) Add(elem interface{}) (old interface{}, replaced bool) {
+	if n := pget(w.root, elem, w.cmp); n != nil {
+		old, replaced = n.elem, true
+	} else {
+		w.size++
+	}
+	w.root = pinsert(w.root, elem, w.cmp)
+	w.changed = true
+	return old, replaced
+}
+
+// Remove removes the element equal to elem, returning it as RBTree.Remove
+// does.
+func (w *VersionWriter) Remove(elem interface{}) (removed interface{}, ok bool) {
+	n := pget(w.root, elem, w.cmp)
+	if n == nil {
+		return nil, false
+	}
+	w.root = pdelete(w.root, elem, w.cmp)
+	w.size--
+	w.changed = true
+	return n.elem, true
+}
+
+// Update calls f to make changes, and commits them together as one new
+// version, which it returns. If f makes no changes, or panics, no version is
+// committed and the current version is returned. Other commits wait until
+// Update returns.
+func (v *VersionedTree) Update(f func(w *VersionWriter)) uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.current.update(f)
+	if s == v.current {
+		return s.version
+	}
+	v.current = s
+	v.retained[s.version] = s
+	return s.version
+}
+
+// update returns the snapshot, with the next version number, that results
+// from the changes f makes to s. It returns s if f makes no changes.
+func (s *Snapshot) update(f func(w *VersionWriter)) *Snapshot {
+	w := &VersionWriter{Snapshot: *s}
+	f(w)
+	if !w.changed {
+		return s
+	}
+	// Copied, so that a writer kept past f can't change the new snapshot.
+	next := new(Snapshot)
+	*next = w.Snapshot
+	next.version = s.version + 1
+	return next
+}
+
+// Add adds elem as a new version, returning the element it replaced as
+// RBTree.Add does, and the version.
+func (v *VersionedTree) Add(elem interface{}) (old interface{}, replaced bool, version uint64) {
+	version = v.Update(func(w *VersionWriter) {
+		old, replaced = w.Add(elem)
+	})
+	return old, replaced, version
+}
+
+// Remove removes the element equal to elem as a new version, returning it as
+// RBTree.Remove does, and the version. If no element was removed, no version
+// is committed and the current version is returned.
+func (v *VersionedTree) Remove(elem interface{}) (removed interface{}, ok bool, version uint64) {
+	version = v.Update(func(w *VersionWriter) {
+		removed, ok = w.Remove(elem)
+	})
+	return removed, ok, version
+}
+
+// Version returns the current version.
+func (v *VersionedTree) Version() uint64 {
+	return v.Current().version
+}
+
+// Current returns a Snapshot of the current version. The current version is
+// always available, even if it has been released.
+func (v *VersionedTree) Current() *Snapshot {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.current
+}
+
+// AsOf returns a Snapshot of the given version, or ErrVersionUnavailable if
+// it has been released or not yet committed.
+func (v *VersionedTree) AsOf(version uint64) (*Snapshot, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if version == v.current.version {
+		return v.current, nil
+	}
+	if s, ok := v.retained[version]; ok {
+		return s, nil
+	}
+	return nil, ErrVersionUnavailable
+}
+
+// Release stops the tree retaining the given version, so that its nodes can
+// be reclaimed once no Snapshot of it is in use. Snapshots of it already
+// returned by AsOf remain valid.
+func (v *VersionedTree) Release(version uint64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.retained, version)
+}
+
+// ReleaseBefore releases every version older than the given one.
+func (v *VersionedTree) ReleaseBefore(version uint64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for ver := range v.retained {
+		if ver < version {
+			delete(v.retained, ver)
+		}
+	}
+}
+
+// Versions returns the retained versions in increasing order.
+func (v *VersionedTree) Versions() []uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	versions := make([]uint64, 0, len(v.retained))
+	for ver := range v.retained {
+		versions = append(versions, ver)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// Version returns the version that s is a snapshot of.
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Contains returns whether elem existed as of the snapshot's version.
+func (s *Snapshot) Contains(elem interface{}) bool {
+	return pget(s.root, elem, s.cmp) != nil
+}
+
+// Get returns the element equal to probe, or (nil, false) if none exists.
+func (s *Snapshot) Get(probe interface{}) (interface{}, bool) {
+	return pelem(pget(s.root, probe, s.cmp))
+}
+
+// Ceiling returns the least element greater than or equal to elem, or
+// (nil, false) if none exists.
+func (s *Snapshot) Ceiling(elem interface{}) (interface{}, bool) {
+	return pelem(pceiling(s.root, elem, s.cmp))
+}
+
+// Floor returns the greatest element less than or equal to elem, or
+// (nil, false) if none exists.
+func (s *Snapshot) Floor(elem interface{}) (interface{}, bool) {
+	return pelem(pfloor(s.root, elem, s.cmp))
+}
+
+// First returns the smallest element or (nil, false) if s.Size() == 0.
+func (s *Snapshot) First() (interface{}, bool) {
+	n := s.root
+	for n != nil && n.left != nil {
+		n = n.left
+	}
+	return pelem(n)
+}
+
+// Last returns the largest element or (nil, false) if s.Size() == 0.
+func (s *Snapshot) Last() (interface{}, bool) {
+	n := s.root
+	for n != nil && n.right != nil {
+		n = n.right
+	}
+	return pelem(n)
+}
+
+// Size returns the number of elements.
+func (s *Snapshot) Size() int {
+	return s.size
+}
+
+// IsEmpty returns whether there are no elements.
+func (s *Snapshot) IsEmpty() bool {
+	return s.size == 0
+}
+
+// ForEach iterates over the elements in sorted order, calling f on each.
+func (s *Snapshot) ForEach(f func(interface{})) {
+	pforEach(s.root, f)
+}
+
+// ToSlice returns the elements in a sorted slice.
+func (s *Snapshot) ToSlice() (elems []interface{}) {
+	s.ForEach(func(a interface{}) {
+		elems = append(elems, a)
+	})
+	return
+}
+
+// String returns a string representation of the snapshot, including its
+// version, size and first and last elements, if they exist.
+func (s *Snapshot) String() string {
+	str := "Snapshot<"
+	str += "Version: " + strconv.FormatUint(s.version, 10)
+	str += ", Size: " + strconv.Itoa(s.Size())
+	if first, exists := s.First(); exists {
+		str += ", First: " + fmt.Sprintf("%v", first)
+	}
+	if last, exists := s.Last(); exists {
+		str += ", Last: " + fmt.Sprintf("%v", last)
+	}
+	str += ">"
+	return str
+}
+
+func pelem(n *pnode) (interface{}, bool) {
+	if n == nil {
+		return nil, false
+	}
+	return n.elem, true
+}
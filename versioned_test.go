@@ -0,0 +1,222 @@
+package rbtree
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// checkPersistent verifies the red-black and ordering invariants of a
+// snapshot's tree.
+func checkPersistent(t *testing.T, s *Snapshot) {
+	if isRed(s.root) {
+		t.Fatal("Root is red.")
+	}
+	count := 0
+	var walk func(n *pnode) int
+	walk = func(n *pnode) int {
+		if n == nil {
+			return 1
+		}
+		count++
+		if isRed(n) && (isRed(n.left) || isRed(n.right)) {
+			t.Fatalf("Red node %v has a red child.", n.elem)
+		}
+		if n.left != nil && s.cmp(n.left.elem, n.elem) >= 0 ||
+			n.right != nil && s.cmp(n.right.elem, n.elem) <= 0 {
+			t.Fatalf("Node %v is out of order.", n.elem)
+		}
+		lh, rh := walk(n.left), walk(n.right)
+		if lh != rh {
+			t.Fatalf("Unequal black heights below %v.", n.elem)
+		}
+		if n.color == black {
+			lh++
+		}
+		return lh
+	}
+	walk(s.root)
+	if count != s.size {
+		t.Fatalf("Expected size %v. Got %v", count, s.size)
+	}
+}
+
+func TestVersioned_AsOf(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	v := NewVersioned(IntComparator)
+	model := New(IntComparator)
+	history := map[uint64][]interface{}{0: nil}
+	for i := 0; i < 3000; i++ {
+		x := r.Intn(300)
+		var version uint64
+		if r.Intn(3) == 0 {
+			_, ok, ver := v.Remove(x)
+			if _, want := model.Remove(x); ok != want {
+				t.Fatalf("Remove(%v) returned %v.", x, ok)
+			}
+			version = ver
+		} else {
+			_, replaced, ver := v.Add(x)
+			if _, want := model.Add(x); replaced != want {
+				t.Fatalf("Add(%v) returned replaced = %v.", x, replaced)
+			}
+			version = ver
+		}
+		history[version] = model.ToSlice()
+		if version != uint64(len(history)-1) {
+			t.Fatalf("Expected version %v. Got %v", len(history)-1, version)
+		}
+	}
+	for version, want := range history {
+		s, err := v.AsOf(version)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		checkPersistent(t, s)
+		if s.Version() != version || !reflect.DeepEqual(s.ToSlice(), want) {
+			t.Fatalf("Version %v: expected %v. Got %v", version, want, s.ToSlice())
+		}
+	}
+	if _, err := v.AsOf(v.Version() + 1); err != ErrVersionUnavailable {
+		t.Fatalf("Expected %v. Got %v", ErrVersionUnavailable, err)
+	}
+}
+
+func TestVersioned_Update(t *testing.T) {
+	v := NewVersioned(IntComparator)
+	version := v.Update(func(w *VersionWriter) {
+		for i := 0; i < 10; i++ {
+			w.Add(i)
+		}
+		w.Remove(5)
+		if w.Contains(5) || !w.Contains(4) || w.Size() != 9 {
+			t.Fatal("VersionWriter doesn't see its own changes.")
+		}
+	})
+	if version != 1 {
+		t.Fatalf("Expected version 1. Got %v", version)
+	}
+	if version := v.Update(func(w *VersionWriter) { w.Remove(5) }); version != 1 {
+		t.Fatalf("Expected no new version without changes. Got %v", version)
+	}
+	func() {
+		defer func() { recover() }()
+		v.Update(func(w *VersionWriter) {
+			w.Add(100)
+			panic("abandon")
+		})
+	}()
+	if v.Version() != 1 || v.Current().Contains(100) {
+		t.Fatal("Update committed changes despite panicking.")
+	}
+	s := v.Current()
+	if s.String() != "Snapshot<Version: 1, Size: 9, First: 0, Last: 9>" {
+		t.Fatalf("Unexpected string %v", s.String())
+	}
+	if floor, _ := s.Floor(5); floor != 4 {
+		t.Fatalf("Expected 4. Got %v", floor)
+	}
+	if ceil, _ := s.Ceiling(5); ceil != 6 {
+		t.Fatalf("Expected 6. Got %v", ceil)
+	}
+}
+
+func TestVersioned_Release(t *testing.T) {
+	v := NewVersioned(IntComparator)
+	for i := 0; i < 10; i++ {
+		v.Add(i)
+	}
+	old, _ := v.AsOf(3)
+	v.Release(3)
+	v.ReleaseBefore(2)
+	if _, err := v.AsOf(3); err != ErrVersionUnavailable {
+		t.Fatalf("Expected %v. Got %v", ErrVersionUnavailable, err)
+	}
+	want := []uint64{2, 4, 5, 6, 7, 8, 9, 10}
+	if !reflect.DeepEqual(v.Versions(), want) {
+		t.Fatalf("Expected %v. Got %v", want, v.Versions())
+	}
+	if !reflect.DeepEqual(old.ToSlice(), ints(0, 3, 1)) {
+		t.Fatal("Snapshot changed after its version was released.")
+	}
+	v.Release(10)
+	if s, err := v.AsOf(10); err != nil || s.Size() != 10 {
+		t.Fatal("Expected the current version to stay available.")
+	}
+}
+
+func TestVersioned_ReleaseReclaimsNodes(t *testing.T) {
+	v := NewVersioned(IntComparator)
+	v.Add(1)
+	reclaimed := make(chan bool, 1)
+	s, _ := v.AsOf(1)
+	runtime.SetFinalizer(s.root, func(*pnode) { reclaimed <- true })
+	s = nil
+	// Version 2 shares no nodes with version 1, whose only node is replaced.
+	v.Add(2)
+	v.Release(1)
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		select {
+		case <-reclaimed:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("Expected nodes of released version to be reclaimed.")
+}
+
+func TestVersioned_ConcurrentReaders(t *testing.T) {
+	v := NewVersioned(IntComparator)
+	var wg sync.WaitGroup
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// Version n holds exactly the elements 0 to n-1.
+				s := v.Current()
+				if s.Size() != int(s.Version()) {
+					t.Errorf("Version %v has size %v.", s.Version(), s.Size())
+					return
+				}
+				if s.Size() > 0 {
+					if last, _ := s.Last(); last != s.Size()-1 {
+						t.Errorf("Version %v has last element %v.", s.Version(), last)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < 2000; i++ {
+		v.Add(i)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func BenchmarkAdd_Random_Ints_Versioned(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		v := NewVersioned(IntComparator)
+		v.Update(func(w *VersionWriter) {
+			for j := 0; j < startingSize; j++ {
+				w.Add(rand.Int())
+			}
+		})
+		b.StartTimer()
+		for j := 0; j < opsToBench; j++ {
+			v.Add(rand.Int())
+		}
+	}
+}
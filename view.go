@@ -0,0 +1,261 @@
+package rbtree
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrOutOfRange is returned when adding an element that lies outside a
+// View's range.
+var ErrOutOfRange = errors.New("rbtree: element outside view's range")
+
+// View is a live view of the elements of an RBTree that lie within a range,
+// optionally in descending order. It holds no elements of its own: changes to
+// the tree are seen by the view, and changes made through the view are made
+// to the tree.
+//
+// Size requires a walk of the range, and so is O(k) for a range of k
+// elements, unlike RBTree.Size.
+type View struct {
+	tree *RBTree
+
+	lo, hi       interface{}
+	hasLo, hasHi bool
+	loInclusive  bool
+	hiInclusive  bool
+	descending   bool
+}
+
+// SubSet returns a view of the elements between lo and hi. Each bound is
+// included in the range only if the matching inclusive flag is set.
+func (t *RBTree) SubSet(lo, hi interface{}, loInclusive, hiInclusive bool) *View {
+	if t.typed {
+		t.checkElem(lo)
+		t.checkElem(hi)
+	}
+	return &View{
+		tree:        t,
+		lo:          lo,
+		hi:          hi,
+		hasLo:       true,
+		hasHi:       true,
+		loInclusive: loInclusive,
+		hiInclusive: hiInclusive,
+	}
+}
+
+// HeadSet returns a view of the elements less than hi, or equal to it if
+// inclusive is set.
+func (t *RBTree) HeadSet(hi interface{}, inclusive bool) *View {
+	if t.typed {
+		t.checkElem(hi)
+	}
+	return &View{tree: t, hi: hi, hasHi: true, hiInclusive: inclusive}
+}
+
+// TailSet returns a view of the elements greater than lo, or equal to it if
+// inclusive is set.
+func (t *RBTree) TailSet(lo interface{}, inclusive bool) *View {
+	if t.typed {
+		t.checkElem(lo)
+	}
+	return &View{tree: t, lo: lo, hasLo: true, loInclusive: inclusive}
+}
+
+// Descending returns a view of all of the tree's elements in descending
+// order.
+func (t *RBTree) Descending() *View {
+	return &View{tree: t, descending: true}
+}
+
+// Descending returns a view of the same range in the opposite order.
+func (v *View) Descending() *View {
+	d := *v
+	d.descending = !v.descending
+	return &d
+}
+
+// Add adds elem to the underlying tree as RBTree.Add does, or returns
+// ErrOutOfRange if elem lies outside the view's range.
+func (v *View) Add(elem interface{}) (old interface{}, replaced bool, err error) {
+	if v.tree.typed {
+		v.tree.checkElem(elem)
+	}
+	if !v.inRange(elem) {
+		return nil, false, ErrOutOfRange
+	}
+	old, replaced = v.tree.Add(elem)
+	return old, replaced, nil
+}
+
+// Remove removes elem from the underlying tree as RBTree.Remove does. Elements
+// outside the view's range are never removed.
+func (v *View) Remove(elem interface{}) (removed interface{}, ok bool) {
+	if v.tree.typed {
+		v.tree.checkElem(elem)
+	}
+	if !v.inRange(elem) {
+		return nil, false
+	}
+	return v.tree.Remove(elem)
+}
+
+// Contains reports whether elem lies within the view's range and exists in
+// the underlying tree.
+func (v *View) Contains(elem interface{}) bool {
+	if v.tree.typed {
+		v.tree.checkElem(elem)
+	}
+	return v.inRange(elem) && v.tree.getNode(elem) != nil
+}
+
+// First returns the view's first element in the view's order, or (nil, false)
+// if the view is empty.
+func (v *View) First() (interface{}, bool) {
+	if n := v.firstNode(); n != nilNode {
+		return n.elem, true
+	}
+	return nil, false
+}
+
+// Last returns the view's last element in the view's order, or (nil, false)
+// if the view is empty.
+func (v *View) Last() (interface{}, bool) {
+	if n := v.lastNode(); n != nilNode {
+		return n.elem, true
+	}
+	return nil, false
+}
+
+// Size returns the number of elements in the view.
+func (v *View) Size() int {
+	size := 0
+	v.ForEach(func(interface{}) {
+		size++
+	})
+	return size
+}
+
+// IsEmpty returns whether the view is empty.
+func (v *View) IsEmpty() bool {
+	return v.firstNode() == nilNode
+}
+
+// ForEach iterates over the view's elements in the view's order, calling f on
+// each. Like RBTree.ForEach, it panics with ErrModified if f adds or removes
+// elements.
+func (v *View) ForEach(f func(interface{})) {
+	it := v.Iterator()
+	for it.Next() {
+		f(it.Value())
+	}
+	if err := it.Err(); err != nil {
+		panic(err)
+	}
+}
+
+// Iterator returns an iterator over the view's elements in the view's order.
+func (v *View) Iterator() *Iterator {
+	// firstNode satisfies the near bound, so only the far one needs checking.
+	it := newIterator(v.tree, v.firstNode(), v.descending)
+	if v.descending {
+		if v.hasLo {
+			it.within = v.aboveLo
+		}
+	} else if v.hasHi {
+		it.within = v.belowHi
+	}
+	return it
+}
+
+// ToSlice returns the view's elements in a slice, in the view's order.
+func (v *View) ToSlice() (s []interface{}) {
+	v.ForEach(func(a interface{}) {
+		s = append(s, a)
+	})
+	return
+}
+
+// String returns a string representation of the view, including its size
+// and first and last elements, if they exist.
+func (v *View) String() string {
+	s := "View<"
+	s += "Size: " + strconv.Itoa(v.Size())
+	if first, exists := v.First(); exists {
+		s += ", First: " + fmt.Sprintf("%v", first)
+	}
+	if last, exists := v.Last(); exists {
+		s += ", Last: " + fmt.Sprintf("%v", last)
+	}
+	s += ">"
+	return s
+}
+
+// Returns the node holding the view's first element in the view's order, or
+// nilNode if the view is empty.
+func (v *View) firstNode() *node {
+	if v.descending {
+		return v.highNode()
+	}
+	return v.lowNode()
+}
+
+func (v *View) lastNode() *node {
+	if v.descending {
+		return v.lowNode()
+	}
+	return v.highNode()
+}
+
+// Returns the node holding the view's smallest element, or nilNode.
+func (v *View) lowNode() *node {
+	t := v.tree
+	var n *node
+	if v.hasLo {
+		n = t.ceilingNode(v.lo, v.loInclusive)
+	} else {
+		n = t.min
+	}
+	if n != nilNode && !v.belowHi(n.elem) {
+		return nilNode
+	}
+	return n
+}
+
+// Returns the node holding the view's largest element, or nilNode.
+func (v *View) highNode() *node {
+	t := v.tree
+	var n *node
+	if v.hasHi {
+		n = t.floorNode(v.hi, v.hiInclusive)
+	} else {
+		n = t.max
+	}
+	if n != nilNode && !v.aboveLo(n.elem) {
+		return nilNode
+	}
+	return n
+}
+
+func (v *View) inRange(elem interface{}) bool {
+	return v.aboveLo(elem) && v.belowHi(elem)
+}
+
+// Returns whether elem satisfies the view's lower bound.
+func (v *View) aboveLo(elem interface{}) bool {
+	if !v.hasLo {
+		return true
+	}
+	cmp := v.tree.cmp(elem, v.lo)
+	return cmp > 0 || cmp == 0 && v.loInclusive
+}
+
+// Returns whether elem satisfies the view's upper bound.
+func (v *View) belowHi(elem interface{}) bool {
+	if !v.hasHi {
+		return true
+	}
+	cmp := v.tree.cmp(elem, v.hi)
+	return cmp < 0 || cmp == 0 && v.hiInclusive
+}
@@ -0,0 +1,124 @@
+package rbtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newRangeTree(lo, hi int) *RBTree {
+	s := New(IntComparator)
+	for i := lo; i < hi; i++ {
+		s.Add(i)
+	}
+	return s
+}
+
+func ints(lo, hi, step int) (s []interface{}) {
+	for i := lo; i != hi; i += step {
+		s = append(s, i)
+	}
+	return
+}
+
+func TestViews_Contents(t *testing.T) {
+	s := newRangeTree(0, 10)
+	cases := []struct {
+		name string
+		v    *View
+		want []interface{}
+	}{
+		{"SubSet[3,7)", s.SubSet(3, 7, true, false), ints(3, 7, 1)},
+		{"SubSet(3,7]", s.SubSet(3, 7, false, true), ints(4, 8, 1)},
+		{"SubSet[3,7]", s.SubSet(3, 7, true, true), ints(3, 8, 1)},
+		{"SubSet(3,4)", s.SubSet(3, 4, false, false), nil},
+		{"SubSet[7,3]", s.SubSet(7, 3, true, true), nil},
+		{"SubSet[-5,50)", s.SubSet(-5, 50, true, false), ints(0, 10, 1)},
+		{"HeadSet(5)", s.HeadSet(5, false), ints(0, 5, 1)},
+		{"HeadSet(5]", s.HeadSet(5, true), ints(0, 6, 1)},
+		{"TailSet(5)", s.TailSet(5, false), ints(6, 10, 1)},
+		{"TailSet[5)", s.TailSet(5, true), ints(5, 10, 1)},
+		{"Descending", s.Descending(), ints(9, -1, -1)},
+		{"SubSet[3,7).Descending", s.SubSet(3, 7, true, false).Descending(), ints(6, 2, -1)},
+		{"Descending.Descending", s.Descending().Descending(), ints(0, 10, 1)},
+	}
+	for _, c := range cases {
+		if got := c.v.ToSlice(); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%v: Expected %v. Got %v", c.name, c.want, got)
+		}
+		if c.v.Size() != len(c.want) {
+			t.Fatalf("%v: Expected size %v. Got %v", c.name, len(c.want), c.v.Size())
+		}
+		if c.v.IsEmpty() != (len(c.want) == 0) {
+			t.Fatalf("%v: IsEmpty() = %v", c.name, c.v.IsEmpty())
+		}
+		first, ok := c.v.First()
+		if len(c.want) == 0 {
+			if ok {
+				t.Fatalf("%v: Empty view had first element %v", c.name, first)
+			}
+			continue
+		}
+		if first != c.want[0] {
+			t.Fatalf("%v: Expected first %v. Got %v", c.name, c.want[0], first)
+		}
+		if last, _ := c.v.Last(); last != c.want[len(c.want)-1] {
+			t.Fatalf("%v: Expected last %v. Got %v", c.name, c.want[len(c.want)-1], last)
+		}
+	}
+}
+
+func TestView_Contains(t *testing.T) {
+	s := newRangeTree(0, 10)
+	v := s.SubSet(3, 7, true, false)
+	for i := -1; i < 11; i++ {
+		if want := i >= 3 && i < 7; v.Contains(i) != want {
+			t.Fatalf("Contains(%v) = %v", i, !want)
+		}
+	}
+}
+
+func TestView_ReflectsParentMutations(t *testing.T) {
+	s := newRangeTree(0, 10)
+	v := s.HeadSet(5, false)
+	s.Remove(0)
+	s.Add(-3)
+	s.Add(20)
+	if want := []interface{}{-3, 1, 2, 3, 4}; !reflect.DeepEqual(v.ToSlice(), want) {
+		t.Fatalf("Expected %v. Got %v", want, v.ToSlice())
+	}
+	s.Clear()
+	if !v.IsEmpty() {
+		t.Fatal("View of cleared tree wasn't empty.")
+	}
+}
+
+func TestView_Add(t *testing.T) {
+	s := New(IntComparator)
+	v := s.SubSet(10, 20, true, false)
+	if _, _, err := v.Add(20); err != ErrOutOfRange {
+		t.Fatalf("Expected ErrOutOfRange. Got %v", err)
+	}
+	if _, _, err := v.Add(9); err != ErrOutOfRange {
+		t.Fatalf("Expected ErrOutOfRange. Got %v", err)
+	}
+	if _, replaced, err := v.Add(10); replaced || err != nil {
+		t.Fatalf("Unexpected return: %v, %v", replaced, err)
+	}
+	if s.Size() != 1 || !s.Contains(10) {
+		t.Fatal("Add through view didn't reach tree.")
+	}
+}
+
+func TestView_Remove(t *testing.T) {
+	s := newRangeTree(0, 10)
+	v := s.TailSet(5, true)
+	if _, ok := v.Remove(4); ok {
+		t.Fatal("Removed element outside view.")
+	}
+	if removed, ok := v.Remove(5); !ok || removed != 5 {
+		t.Fatalf("Expected (5, true). Got (%v, %v)", removed, ok)
+	}
+	if s.Contains(5) || !s.Contains(4) {
+		t.Fatal("Remove through view didn't reach tree.")
+	}
+}